@@ -0,0 +1,90 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Build metadata, set at build time using -ldflags, e.g.
+//
+//	go build -ldflags "-X weathering-with-go/buildinfo.Version=v1.2.0 -X weathering-with-go/buildinfo.Commit=$(git rev-parse HEAD)"
+//
+// Values left empty are filled in from the module and VCS information embedded by the Go toolchain.
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// DevVersion is reported when no version was set at build time and the module has none
+const DevVersion = "dev"
+
+// Info describes the running binary
+type Info struct {
+	Version   string       `json:"version"`
+	Commit    string       `json:"commit,omitempty"`
+	BuildDate string       `json:"build_date,omitempty"`
+	Modified  bool         `json:"modified,omitempty"` // built from a working tree with uncommitted changes
+	GoVersion string       `json:"go_version"`
+	Module    string       `json:"module,omitempty"`
+	Deps      []Dependency `json:"deps,omitempty"`
+}
+
+// Dependency describes a module linked into the binary
+type Dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// Get returns the build information of the running binary; it is computed once
+var Get = sync.OnceValue(func() Info {
+	bi, _ := debug.ReadBuildInfo()
+	return read(bi)
+})
+
+// read combines the ldflags values with the toolchain's build information, which may be nil
+func read(bi *debug.BuildInfo) Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi != nil {
+		info.Module = bi.Main.Path
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+
+		for _, dep := range bi.Deps {
+			d := Dependency{Path: dep.Path, Version: dep.Version}
+			if dep.Replace != nil {
+				d.Replace = dep.Replace.Path + "@" + dep.Replace.Version
+			}
+			info.Deps = append(info.Deps, d)
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = DevVersion
+	}
+	return info
+}
@@ -0,0 +1,45 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestReadPrefersLdflags(t *testing.T) {
+	Version, Commit, BuildDate = "v1.2.3", "abc123", "2026-03-01T10:00:00Z"
+	defer func() { Version, Commit, BuildDate = "", "", "" }()
+
+	info := read(&debug.BuildInfo{
+		Main:     debug.Module{Path: "weathering-with-go", Version: "v0.9.0"},
+		Deps:     []*debug.Module{{Path: "github.com/gin-gonic/gin", Version: "v1.11.0"}},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "def456"}, {Key: "vcs.modified", Value: "true"}},
+	})
+
+	if info.Version != "v1.2.3" || info.Commit != "abc123" || info.BuildDate != "2026-03-01T10:00:00Z" {
+		t.Fatalf("expected ldflags values, got %+v", info)
+	}
+	if !info.Modified || info.Module != "weathering-with-go" || info.GoVersion != runtime.Version() {
+		t.Fatalf("unexpected build details: %+v", info)
+	}
+	if len(info.Deps) != 1 || info.Deps[0].Path != "github.com/gin-gonic/gin" {
+		t.Fatalf("unexpected deps: %+v", info.Deps)
+	}
+}
+
+func TestReadFallsBackToToolchainInfo(t *testing.T) {
+	info := read(&debug.BuildInfo{
+		Main:     debug.Module{Path: "weathering-with-go", Version: "v0.9.0"},
+		Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "def456"}, {Key: "vcs.time", Value: "2026-02-01T00:00:00Z"}},
+	})
+	if info.Version != "v0.9.0" || info.Commit != "def456" || info.BuildDate != "2026-02-01T00:00:00Z" || info.Modified {
+		t.Fatalf("expected toolchain values, got %+v", info)
+	}
+
+	if info := read(&debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}); info.Version != DevVersion {
+		t.Fatalf("expected %q for development builds, got %q", DevVersion, info.Version)
+	}
+	if info := read(nil); info.Version != DevVersion || info.GoVersion == "" {
+		t.Fatalf("unexpected info without build information: %+v", info)
+	}
+}
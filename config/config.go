@@ -1,9 +1,12 @@
 package config
 
 import (
-	"log"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // BuildTimeAPIKey can be set at build time using -ldflags
@@ -13,53 +16,341 @@ var Environment string
 // Config holds all configuration for the application
 type Config struct {
 	// Server configuration
-	Port string
-	Host string
+	Port           string
+	Host           string
+	TrustedProxies []string // IPs or CIDRs of proxies whose X-Forwarded-For is believed; empty trusts none
 
 	// API configuration
-	OpenWeatherMapAPIKey string
+	OpenWeatherMapAPIKey  string
+	OpenWeatherMapAPIKeys []string      // further keys rotated with OpenWeatherMapAPIKey
+	KeyRotation           string        // round-robin or remaining-quota
+	KeyDailyQuota         int           // upstream calls per key per UTC day; 0 is unlimited
+	KeyBenchDuration      time.Duration // how long a key rejected with 401 or 429 is left out
+	AllowCallerKeys       bool          // accept callers' own OpenWeatherMap keys via header
 
 	// Application configuration
-	Environment string // development, production, testing
-	LogLevel    string // debug, info, warn, error
+	Environment  string   // development, production, testing
+	LogLevel     string   // debug, info, warn, error
+	RedactParams []string // extra query parameters masked in logs
+
+	// Tracing configuration; tracing is enabled when an OTLP endpoint is set
+	TracingEndpoint    string  // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	TracingServiceName string  // service.name resource attribute
+	TracingSampleRatio float64 // fraction of new traces sampled; child spans follow their parent
+
+	// Observation history configuration
+	ObservationsDBPath    string        // empty disables the observation store
+	ObservationsRetention time.Duration // how long observations are kept
+
+	// Background polling configuration
+	WatchedLocations []WatchedLocation
+	WatchInterval    time.Duration // refresh interval for watched locations that do not set one
+	WatchConcurrency int           // maximum concurrent upstream refreshes
+
+	// Client authentication configuration
+	APIKeys         []ClientAPIKey // keys given in plain text; hashed when loaded
+	APIKeysFile     string         // JSON file of hashed keys
+	AnonymousScopes []string       // scopes anonymous callers have while no authentication is configured
+
+	// JWT bearer authentication configuration; enabled when any key source is set
+	JWTSecret        string        // shared secret for HS256 tokens
+	JWTPublicKeyFile string        // PEM-encoded RSA public key for RS256 tokens
+	JWTJWKSFile      string        // local JWKS file with RSA and/or symmetric keys
+	JWTIssuer        string        // required "iss" claim; empty skips the check
+	JWTAudience      string        // required "aud" claim; empty skips the check
+	JWTLeeway        time.Duration // clock skew tolerated for exp/nbf/iat
+
+	// CORS configuration
+	CORSAllowedOrigins   []string      // exact origins or wildcard patterns such as https://*.example.com; "*" allows any
+	CORSAllowCredentials bool          // allow cookies and Authorization on cross-origin requests
+	CORSMaxAge           time.Duration // how long browsers may cache preflight results
+
+	// Security header configuration
+	ContentSecurityPolicy     string // empty omits the header
+	PermissionsPolicy         string
+	CrossOriginResourcePolicy string        // same-origin, same-site or cross-origin
+	HSTSMaxAge                time.Duration // Strict-Transport-Security max-age on TLS; 0 disables HSTS
+
+	// Request limits and server timeouts
+	MaxBodyBytes      int64         // largest accepted request body
+	MaxHeaderBytes    int           // largest accepted request header block
+	ReadHeaderTimeout time.Duration // time allowed to read request headers
+	ReadTimeout       time.Duration // time allowed to read the whole request
+	WriteTimeout      time.Duration // time allowed to write the response
+	IdleTimeout       time.Duration // how long idle keep-alive connections are kept
+
+	// TLS and HTTP/2 serving; plain HTTP/1.1 unless a certificate is configured
+	TLSCertFile     string   // PEM certificate chain; reloaded when it changes on disk
+	TLSKeyFile      string   // PEM private key for TLSCertFile
+	TLSClientCAFile string   // PEM CA bundle enabling mutual TLS client authentication
+	TLSClientAuth   string   // optional or require client certificates when TLSClientCAFile is set
+	TLSClientScopes []string // scopes granted to callers authenticated by client certificate
+	H2CEnabled      bool     // accept prior-knowledge HTTP/2 over plaintext connections
+
+	// Graceful shutdown
+	ShutdownDrainDelay time.Duration // how long readiness fails before the listener closes
+	ShutdownTimeout    time.Duration // how long in-flight requests get to finish
+
+	// Rate limiting configuration
+	RateLimitEnabled   bool
+	RateLimitPerMinute float64 // sustained requests per minute per client
+	RateLimitBurst     int     // requests a client may make at once
+
+	// Upstream usage accounting configuration
+	UsageFile    string // JSON file persisting usage counters; empty keeps them in memory
+	DailyQuota   int    // upstream calls per client per UTC day; 0 is unlimited
+	MonthlyQuota int    // upstream calls per client per UTC month; 0 is unlimited
+
+	// ConfigFile is the config file the settings were loaded from, if any
+	ConfigFile string
+	// PrintConfig asks for the effective configuration to be printed instead of serving
+	PrintConfig bool
+
+	sources    map[string]string // where each setting's value came from, by config file key
+	loadErrors ConfigErrors      // problems found while loading, reported by Validate
+}
+
+// ClientAPIKey is a client API key supplied through configuration
+type ClientAPIKey struct {
+	Owner  string
+	Key    string
+	Scopes []string
+}
+
+// WatchedLocation is a location the background poller keeps fresh
+type WatchedLocation struct {
+	Location string
+	Units    string
+	Interval time.Duration // negative when the configured interval could not be parsed
 }
 
-// Load loads configuration from environment variables with defaults
+// Load loads configuration from the defaults, the config file named by CONFIG_FILE and
+// environment variables, ignoring command-line flags; see LoadArgs
 func Load() *Config {
-	apiKey := getEnv("OPENWEATHERMAP_API_KEY", "")
-	// If no runtime API key is found, use build-time API key
-	if apiKey == "" && BuildTimeAPIKey != "" {
-		apiKey = BuildTimeAPIKey
-	}
-	log.Print("====> current api key is: [" + apiKey + "]")
+	cfg, _ := LoadArgs(nil)
+	return cfg
+}
 
-	if Environment == "" {
-		Environment = getEnv("ENVIRONMENT", "development")
+// defaults returns the built-in configuration that the file, environment and flags override
+func defaults() *Config {
+	environment := Environment
+	if environment == "" {
+		environment = "development"
 	}
+
 	return &Config{
 		// Server configuration
-		Port: getEnv("PORT", "8080"),
-		Host: getEnv("HOST", "0.0.0.0"),
+		Port: "8080",
+		Host: "0.0.0.0",
 
-		// API configuration
-		OpenWeatherMapAPIKey: apiKey,
+		// API configuration; a key set at build time is used unless one is configured
+		OpenWeatherMapAPIKey: BuildTimeAPIKey,
+		KeyRotation:          "round-robin",
+		KeyBenchDuration:     5 * time.Minute,
+		AllowCallerKeys:      true,
 
 		// Application configuration
-		Environment: Environment,
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
+		Environment: environment,
+		LogLevel:    "info",
+
+		// Tracing configuration
+		TracingServiceName: "weathering-with-go",
+		TracingSampleRatio: 1,
+
+		// Observation history configuration
+		ObservationsRetention: 30 * 24 * time.Hour,
+
+		// Background polling configuration
+		WatchInterval:    10 * time.Minute,
+		WatchConcurrency: 4,
+
+		// Client authentication configuration; admin and metrics routes stay closed until opted in
+		AnonymousScopes: []string{"weather:read"},
+
+		// JWT bearer authentication configuration
+		JWTLeeway: 30 * time.Second,
+
+		// CORS configuration
+		CORSAllowedOrigins: []string{"*"},
+		CORSMaxAge:         10 * time.Minute,
+
+		// Security header configuration
+		ContentSecurityPolicy:     "default-src 'none'; frame-ancestors 'none'",
+		PermissionsPolicy:         "accelerometer=(), camera=(), geolocation=(), gyroscope=(), microphone=(), payment=(), usb=()",
+		CrossOriginResourcePolicy: "same-origin",
+		HSTSMaxAge:                365 * 24 * time.Hour,
+
+		// Request limits and server timeouts
+		MaxBodyBytes:      1 << 20,
+		MaxHeaderBytes:    1 << 20,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+
+		// TLS and HTTP/2 serving
+		TLSClientAuth: "optional",
+
+		// Graceful shutdown; the defaults fit within Cloud Run's 10 second termination grace period
+		ShutdownTimeout: 8 * time.Second,
+
+		// Rate limiting configuration
+		RateLimitEnabled:   true,
+		RateLimitPerMinute: 60,
+		RateLimitBurst:     20,
 	}
 }
 
-// Validate checks if all required configuration is present
+// Validate checks the loaded configuration, reporting every problem at once: values that could
+// not be parsed, unknown config file settings and invalid combinations. The error is a
+// ConfigErrors list.
 func (c *Config) Validate() error {
-	if c.OpenWeatherMapAPIKey == "" {
-		return &ConfigError{
-			Field:   "OPENWEATHERMAP_API_KEY",
-			Message: "OpenWeatherMap API key is required. Get one at https://openweathermap.org/api",
+	errs := append(ConfigErrors(nil), c.loadErrors...)
+	fail := func(field, message string) {
+		errs = append(errs, &ConfigError{Field: field, Message: message})
+	}
+
+	if len(c.UpstreamKeys()) == 0 {
+		fail("OPENWEATHERMAP_API_KEY", "OpenWeatherMap API key is required. Get one at https://openweathermap.org/api")
+	}
+
+	if c.KeyRotation != "round-robin" && c.KeyRotation != "remaining-quota" {
+		fail("OPENWEATHERMAP_KEY_ROTATION", "invalid key rotation "+c.KeyRotation+"; use round-robin or remaining-quota")
+	}
+
+	if c.KeyDailyQuota < 0 {
+		fail("OPENWEATHERMAP_KEY_DAILY_QUOTA", "must be 0 (unlimited) or positive")
+	}
+
+	if c.KeyBenchDuration <= 0 {
+		fail("OPENWEATHERMAP_KEY_BENCH_DURATION", "must be a positive Go duration such as 5m")
+	}
+
+	if c.WatchInterval <= 0 {
+		fail("WATCH_INTERVAL", "must be a positive Go duration such as 10m")
+	}
+
+	for _, watched := range c.WatchedLocations {
+		if watched.Interval < 0 {
+			fail("WATCHED_LOCATIONS", "invalid refresh interval for "+watched.Location+"; use a Go duration such as 5m")
+		}
+		if watched.Units != "metric" && watched.Units != "imperial" && watched.Units != "kelvin" {
+			fail("WATCHED_LOCATIONS", "invalid units "+watched.Units+" for "+watched.Location+"; use metric, imperial or kelvin")
+		}
+	}
+
+	for _, key := range c.APIKeys {
+		if key.Owner == "" || key.Key == "" {
+			fail("API_KEYS", "entries must be owner:key or owner:key:scope1+scope2")
+			break
+		}
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		fail("LOG_LEVEL", "must be debug, info, warn or error")
+	}
+
+	if c.TracingEndpoint != "" {
+		if u, err := url.Parse(c.TracingEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "must be an http or https URL")
 		}
 	}
 
-	return nil
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		fail("TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+	}
+
+	if c.JWTSecret != "" && len(c.JWTSecret) < 32 {
+		fail("JWT_HMAC_SECRET", "must be at least 32 bytes")
+	}
+
+	if c.JWTLeeway < 0 {
+		fail("JWT_LEEWAY", "must not be negative")
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" && c.CORSAllowCredentials {
+			fail("CORS_ALLOWED_ORIGINS", "\"*\" cannot be combined with CORS_ALLOW_CREDENTIALS; list the trusted origins instead")
+		}
+	}
+
+	if c.CORSMaxAge < 0 {
+		fail("CORS_MAX_AGE", "must not be negative")
+	}
+
+	switch c.CrossOriginResourcePolicy {
+	case "same-origin", "same-site", "cross-origin":
+	default:
+		fail("CROSS_ORIGIN_RESOURCE_POLICY", "must be same-origin, same-site or cross-origin")
+	}
+
+	if c.MaxBodyBytes < 1 || c.MaxHeaderBytes < 1 {
+		fail("MAX_BODY_BYTES", "request size limits must be positive")
+	}
+
+	if c.ReadHeaderTimeout <= 0 || c.ReadTimeout <= 0 || c.WriteTimeout <= 0 || c.IdleTimeout <= 0 {
+		fail("READ_TIMEOUT", "server timeouts must be positive Go durations such as 15s")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("TLS_CERT_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if c.TLSClientCAFile != "" && !c.TLSEnabled() {
+		fail("TLS_CLIENT_CA_FILE", "client certificate authentication requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	if c.TLSClientAuth != "require" && c.TLSClientAuth != "optional" {
+		fail("TLS_CLIENT_AUTH", "invalid client certificate mode "+c.TLSClientAuth+"; use optional or require")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				fail("TRUSTED_PROXIES", "invalid IP address or CIDR "+proxy)
+			}
+		}
+	}
+
+	if c.H2CEnabled && c.TLSEnabled() {
+		fail("H2C_ENABLED", "h2c is plaintext HTTP/2; HTTPS already negotiates HTTP/2, so disable one of them")
+	}
+
+	if c.ShutdownDrainDelay < 0 || c.ShutdownTimeout <= 0 {
+		fail("SHUTDOWN_TIMEOUT", "shutdown timeout must be positive and the drain delay must not be negative")
+	}
+
+	if c.RateLimitEnabled && (c.RateLimitPerMinute <= 0 || c.RateLimitBurst < 1) {
+		fail("RATE_LIMIT_PER_MINUTE", "rate limit must be positive with a burst of at least 1")
+	}
+
+	if c.DailyQuota < 0 || c.MonthlyQuota < 0 {
+		fail("QUOTA_DAILY", "quotas must be 0 (unlimited) or positive")
+	}
+
+	if c.WatchConcurrency < 1 {
+		fail("WATCH_CONCURRENCY", "must be at least 1")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// UpstreamKeys returns the server's OpenWeatherMap keys in rotation order, without duplicates
+func (c *Config) UpstreamKeys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range append([]string{c.OpenWeatherMapAPIKey}, c.OpenWeatherMapAPIKeys...) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
 // IsProduction returns true if running in production environment
@@ -67,6 +358,16 @@ func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
 }
 
+// JWTEnabled reports whether JWT bearer tokens are accepted
+func (c *Config) JWTEnabled() bool {
+	return c.JWTSecret != "" || c.JWTPublicKeyFile != "" || c.JWTJWKSFile != ""
+}
+
+// TLSEnabled reports whether the server serves HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
 // IsDevelopment returns true if running in development environment
 func (c *Config) IsDevelopment() bool {
 	return c.Environment == "development"
@@ -87,30 +388,104 @@ func (e *ConfigError) Error() string {
 	return "Configuration error [" + e.Field + "]: " + e.Message
 }
 
-// getEnv gets an environment variable with a fallback default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// ConfigErrors lists every problem found in a configuration
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
 	}
-	return defaultValue
+
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, strconv.Itoa(len(e))+" configuration errors:")
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
 }
 
-// getEnvAsInt gets an environment variable as integer with a fallback default value
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// Unwrap exposes the individual errors to errors.Is and errors.As
+func (e ConfigErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// parseWatchedLocations parses a semicolon-separated list of "location[@units][=interval]" entries,
+// e.g. "London,UK=5m;New York,NY,US@imperial". Entries without an interval use defaultInterval.
+func parseWatchedLocations(value string, defaultInterval time.Duration) []WatchedLocation {
+	var locations []WatchedLocation
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
 		}
+
+		watched := WatchedLocation{Units: "metric", Interval: defaultInterval}
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			interval, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+			if err != nil {
+				interval = -1
+			}
+			watched.Interval = interval
+			entry = strings.TrimSpace(entry[:i])
+		}
+		if i := strings.LastIndex(entry, "@"); i >= 0 {
+			watched.Units = strings.TrimSpace(entry[i+1:])
+			entry = strings.TrimSpace(entry[:i])
+		}
+		watched.Location = entry
+
+		locations = append(locations, watched)
 	}
-	return defaultValue
+
+	return locations
 }
 
-// getEnvAsBool gets an environment variable as boolean with a fallback default value
-func getEnvAsBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+// parseClientAPIKeys parses a comma-separated list of "owner:key[:scope1+scope2]" entries
+func parseClientAPIKeys(value string) []ClientAPIKey {
+	var keys []ClientAPIKey
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
 		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		key := ClientAPIKey{Owner: strings.TrimSpace(parts[0])}
+		if len(parts) > 1 {
+			key.Key = strings.TrimSpace(parts[1])
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			key.Scopes = strings.Split(parts[2], "+")
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// getEnv gets an environment variable with a fallback default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
 	return defaultValue
 }
+
+// tracingEndpoint returns the OTLP traces URL from the standard OpenTelemetry variables: the
+// signal-specific OTEL_EXPORTER_OTLP_TRACES_ENDPOINT as-is, or OTEL_EXPORTER_OTLP_ENDPOINT plus /v1/traces
+func tracingEndpoint() string {
+	if endpoint := getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""); endpoint != "" {
+		return endpoint
+	}
+	if base := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""); base != "" {
+		return strings.TrimRight(base, "/") + "/v1/traces"
+	}
+	return ""
+}
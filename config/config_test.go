@@ -1,6 +1,15 @@
 package config
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestLoadAndDefaults(t *testing.T) {
 	t.Setenv("PORT", "1234")
@@ -35,3 +44,338 @@ func TestValidateMissingAPIKey(t *testing.T) {
 		t.Fatalf("expected Validate to fail without API key")
 	}
 }
+
+func TestParseWatchedLocations(t *testing.T) {
+	locs := parseWatchedLocations("London,UK=5m; New York,NY,US@imperial ;Paris,FR=soon", 10*time.Minute)
+	if len(locs) != 3 {
+		t.Fatalf("expected 3 locations got %d", len(locs))
+	}
+	if locs[0].Location != "London,UK" || locs[0].Interval != 5*time.Minute || locs[0].Units != "metric" {
+		t.Fatalf("unexpected first location: %+v", locs[0])
+	}
+	if locs[1].Location != "New York,NY,US" || locs[1].Units != "imperial" || locs[1].Interval != 10*time.Minute {
+		t.Fatalf("unexpected second location: %+v", locs[1])
+	}
+
+	cfg := &Config{OpenWeatherMapAPIKey: "key", WatchedLocations: locs, WatchConcurrency: 1}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected Validate to reject the invalid interval")
+	}
+}
+
+func TestLoadDoesNotLogAPIKey(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	t.Setenv("OPENWEATHERMAP_API_KEY", secret)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Load()
+
+	if strings.Contains(buf.String(), secret) {
+		t.Fatalf("API key leaked into log output: %q", buf.String())
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadArgsPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+server:
+  port: 9000
+  host: 127.0.0.1
+  cors:
+    allowed_origins: [https://a.example.com, https://b.example.com]
+providers:
+  openweathermap:
+    api_key: file-key
+cache:
+  watch_interval: 2m
+  watched_locations:
+    - London,UK
+    - Oslo,NO=30s
+rate_limit:
+  per_minute: 30
+  burst: 5
+logging:
+  level: warn
+`)
+	t.Setenv("OPENWEATHERMAP_API_KEY", "")
+	t.Setenv("RATE_LIMIT_BURST", "7")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	cfg, err := LoadArgs([]string{"--config", path, "--logging.level=error", "--rate_limit.enabled=false"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	// The file overrides defaults
+	if cfg.Port != "9000" || cfg.Host != "127.0.0.1" || cfg.OpenWeatherMapAPIKey != "file-key" || cfg.RateLimitPerMinute != 30 {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if len(cfg.CORSAllowedOrigins) != 2 || cfg.CORSAllowedOrigins[1] != "https://b.example.com" {
+		t.Fatalf("unexpected CORS origins: %v", cfg.CORSAllowedOrigins)
+	}
+	if len(cfg.WatchedLocations) != 2 || cfg.WatchedLocations[0].Interval != 2*time.Minute || cfg.WatchedLocations[1].Interval != 30*time.Second {
+		t.Fatalf("unexpected watched locations: %+v", cfg.WatchedLocations)
+	}
+	// The environment overrides the file, and flags override both
+	if cfg.RateLimitBurst != 7 {
+		t.Fatalf("expected burst 7 from the environment, got %d", cfg.RateLimitBurst)
+	}
+	if cfg.LogLevel != "error" || cfg.RateLimitEnabled {
+		t.Fatalf("flags not applied: level %s, rate limit %v", cfg.LogLevel, cfg.RateLimitEnabled)
+	}
+	if cfg.CORSMaxAge != 10*time.Minute {
+		t.Fatalf("expected the default CORS max age, got %s", cfg.CORSMaxAge)
+	}
+}
+
+func TestLoadArgsTOML(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[server]
+port = "8181"
+
+[server.tls]
+client_scopes = ["weather:read", "metrics:read"]
+
+[providers.openweathermap]
+api_key = "toml-key"
+
+[rate_limit]
+enabled = true
+per_minute = 12.5
+`)
+	t.Setenv(ConfigFileEnv, path)
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if cfg.ConfigFile != path || cfg.Port != "8181" || cfg.OpenWeatherMapAPIKey != "toml-key" || cfg.RateLimitPerMinute != 12.5 {
+		t.Fatalf("TOML values not applied: %+v", cfg)
+	}
+	if len(cfg.TLSClientScopes) != 2 || cfg.TLSClientScopes[1] != "metrics:read" {
+		t.Fatalf("unexpected client scopes: %v", cfg.TLSClientScopes)
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+server:
+  port: 8080
+  prot: 8081
+rate_limit:
+  burst: lots
+`)
+	t.Setenv("OPENWEATHERMAP_API_KEY", "key")
+	t.Setenv("READ_TIMEOUT", "soon")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+
+	cfg, err := LoadArgs([]string{"--config=" + path, "--logging.level=loud"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = cfg.Validate()
+	var errs ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ConfigErrors, got %v", err)
+	}
+
+	fieldsSeen := make(map[string]bool)
+	for _, e := range errs {
+		fieldsSeen[e.Field] = true
+	}
+	for _, want := range []string{"server.prot", "rate_limit.burst", "READ_TIMEOUT", "LOG_LEVEL", "TRUSTED_PROXIES"} {
+		if !fieldsSeen[want] {
+			t.Errorf("expected an error for %s in %v", want, err)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "5 configuration errors:") {
+		t.Errorf("unexpected message: %s", err)
+	}
+}
+
+func TestLoadArgsRejectsUnknownFlags(t *testing.T) {
+	if _, err := LoadArgs([]string{"--server.prot=1"}); err == nil {
+		t.Fatalf("expected an unknown flag to fail")
+	}
+}
+
+func TestReloaderAppliesReloadableSettings(t *testing.T) {
+	t.Setenv("OPENWEATHERMAP_API_KEY", "")
+	path := writeConfigFile(t, "config.yaml", `
+server: {port: 8080}
+providers: {openweathermap: {api_key: first-key-0001, key_rotation: round-robin}}
+rate_limit: {burst: 5}
+logging: {level: info}
+`)
+	args := []string{"--config", path}
+	cfg, err := LoadArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := make(chan *Config, 1)
+	r, err := NewReloader(args, cfg, nil, func(next *Config) { applied <- next })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+
+	// Writing the file triggers a reload; only the reloadable settings take effect
+	if err := os.WriteFile(path, []byte(`
+server: {port: 9090}
+providers: {openweathermap: {api_key: second-key-0002, key_rotation: remaining-quota}}
+rate_limit: {burst: 50}
+logging: {level: debug}
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var next *Config
+	select {
+	case next = <-applied:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("config change was not applied")
+	}
+	if next.RateLimitBurst != 50 || next.LogLevel != "debug" {
+		t.Fatalf("reloadable settings not applied: burst %d, level %s", next.RateLimitBurst, next.LogLevel)
+	}
+	if next.OpenWeatherMapAPIKey != "second-key-0002" || next.KeyRotation != "remaining-quota" {
+		t.Fatalf("expected the upstream key and its rotation to be reloaded")
+	}
+	if next.Port != "8080" {
+		t.Fatalf("settings needing a restart changed: port %s", next.Port)
+	}
+	if r.Current() != next {
+		t.Fatalf("expected Current to return the applied config")
+	}
+
+	// The diff still reports the pending restart-only changes, with secrets redacted
+	changes, err := r.Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	byKey := make(map[string]Change)
+	for _, change := range changes {
+		byKey[change.Key] = change
+	}
+	if port := byKey["server.port"]; port.Reloadable || port.Old != "8080" || port.New != "9090" {
+		t.Fatalf("unexpected port change: %+v", port)
+	}
+	if _, ok := byKey["providers.openweathermap.api_key"]; ok {
+		t.Fatalf("expected the applied key change not to be reported again")
+	}
+	for _, change := range Diff(cfg, next) {
+		if change.Key == "providers.openweathermap.api_key" && strings.Contains(change.Old+change.New, "-key-") {
+			t.Fatalf("secret leaked into diff: %+v", change)
+		}
+	}
+
+	// An invalid file is rejected and the running configuration kept
+	if err := os.WriteFile(path, []byte("rate_limit: {burst: 0}\nlogging: {level: loud}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reload(); err == nil {
+		t.Fatalf("expected an invalid config to be rejected")
+	}
+	if r.Current() != next {
+		t.Fatalf("expected the running config to be kept")
+	}
+}
+
+func TestSecretsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "owm-key")
+	poolFile := filepath.Join(dir, "owm-keys")
+	if err := os.WriteFile(keyFile, []byte("primary-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(poolFile, []byte("second-key\nthird-key\nprimary-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OPENWEATHERMAP_API_KEY", "")
+	t.Setenv("OPENWEATHERMAP_API_KEY_FILE", keyFile)
+	t.Setenv("OPENWEATHERMAP_API_KEYS_FILE", poolFile)
+	t.Setenv("OPENWEATHERMAP_KEY_ROTATION", "Remaining-Quota")
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if got := strings.Join(cfg.UpstreamKeys(), ","); got != "primary-key,second-key,third-key" {
+		t.Fatalf("unexpected upstream keys %s", got)
+	}
+	if cfg.KeyRotation != "remaining-quota" {
+		t.Fatalf("unexpected rotation %s", cfg.KeyRotation)
+	}
+
+	// A secret given both directly and as a file is ambiguous
+	t.Setenv("OPENWEATHERMAP_API_KEY", "direct-key")
+	t.Setenv("JWT_HMAC_SECRET_FILE", filepath.Join(dir, "missing"))
+	err := Load().Validate()
+	for _, want := range []string{"OPENWEATHERMAP_API_KEY_FILE", "JWT_HMAC_SECRET_FILE"} {
+		if err == nil || !strings.Contains(err.Error(), "["+want+"]") {
+			t.Fatalf("expected an error for %s, got %v", want, err)
+		}
+	}
+}
+
+func TestReportSourcesAndRedaction(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[server]
+port = "9000"
+
+[providers.openweathermap]
+api_key = "file-key-abcdef-1111"
+`)
+	t.Setenv("OPENWEATHERMAP_API_KEY", "")
+	t.Setenv("OPENWEATHERMAP_API_KEYS", "env-key-abcdef-2222,env-key-abcdef-3333")
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("API_KEYS", "ops:ops-key-abcdef-4444:admin")
+
+	cfg, err := LoadArgs([]string{"--config", path, "--print-config", "--rate_limit.burst=9"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.PrintConfig {
+		t.Fatalf("expected --print-config to be recorded")
+	}
+
+	report := cfg.Report()
+	if report.ConfigFile != path || len(report.Settings) != len(fields) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	settings := make(map[string]Setting)
+	for _, setting := range report.Settings {
+		settings[setting.Key] = setting
+	}
+
+	expected := map[string][2]string{
+		"server.host":                       {"0.0.0.0", SourceDefault},
+		"server.port":                       {"9000", SourceFile},
+		"logging.level":                     {"warn", SourceEnv},
+		"rate_limit.burst":                  {"9", SourceFlag},
+		"providers.openweathermap.api_key":  {"[REDACTED]1111", SourceFile},
+		"providers.openweathermap.api_keys": {"[REDACTED]2222,[REDACTED]3333", SourceEnv},
+		"auth.api_keys":                     {"ops:[REDACTED]4444:admin", SourceEnv},
+	}
+	for key, want := range expected {
+		if got := settings[key]; got.Value != want[0] || got.Source != want[1] {
+			t.Errorf("%s: expected %q from %s, got %q from %s", key, want[0], want[1], got.Value, got.Source)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"weathering-with-go/redact"
+)
+
+// field describes one setting: its dotted key in the config file (also its command-line flag),
+// its environment variable and how a textual value is applied to a Config
+type field struct {
+	key        string
+	env        string
+	secret     bool   // never printed or logged
+	sep        string // joins list values given as a sequence in a config file
+	isBool     bool   // may be given as a bare command-line flag
+	reloadable bool   // applied to the running server on reload
+	fromFile   bool   // may also be read from the file named by env + "_FILE"
+
+	set      func(c *Config, value string) error
+	get      func(c *Config) string // formats the current value as it would be configured
+	show     func(c *Config) string // optional; displays a secret with only its secret parts redacted
+	copy     func(dst, src *Config) // copies the value between configs
+	envValue func() string          // optional; overrides the plain lookup of env
+}
+
+// fields lists every setting, grouped by config file section
+var fields = []field{
+	// Server
+	stringField("server.host", "HOST", func(c *Config) *string { return &c.Host }),
+	stringField("server.port", "PORT", func(c *Config) *string { return &c.Port }),
+	stringField("server.environment", "ENVIRONMENT", func(c *Config) *string { return &c.Environment }),
+	newField("server.max_body_bytes", "MAX_BODY_BYTES", func(c *Config) *int64 { return &c.MaxBodyBytes }, parseInt64),
+	newField("server.max_header_bytes", "MAX_HEADER_BYTES", func(c *Config) *int { return &c.MaxHeaderBytes }, parseInt),
+	durationField("server.read_header_timeout", "READ_HEADER_TIMEOUT", func(c *Config) *time.Duration { return &c.ReadHeaderTimeout }),
+	durationField("server.read_timeout", "READ_TIMEOUT", func(c *Config) *time.Duration { return &c.ReadTimeout }),
+	durationField("server.write_timeout", "WRITE_TIMEOUT", func(c *Config) *time.Duration { return &c.WriteTimeout }),
+	durationField("server.idle_timeout", "IDLE_TIMEOUT", func(c *Config) *time.Duration { return &c.IdleTimeout }),
+	durationField("server.shutdown_drain_delay", "SHUTDOWN_DRAIN_DELAY", func(c *Config) *time.Duration { return &c.ShutdownDrainDelay }),
+	durationField("server.shutdown_timeout", "SHUTDOWN_TIMEOUT", func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+	boolField("server.h2c", "H2C_ENABLED", func(c *Config) *bool { return &c.H2CEnabled }),
+	listField("server.trusted_proxies", "TRUSTED_PROXIES", func(c *Config) *[]string { return &c.TrustedProxies }),
+	stringField("server.tls.cert_file", "TLS_CERT_FILE", func(c *Config) *string { return &c.TLSCertFile }),
+	stringField("server.tls.key_file", "TLS_KEY_FILE", func(c *Config) *string { return &c.TLSKeyFile }),
+	stringField("server.tls.client_ca_file", "TLS_CLIENT_CA_FILE", func(c *Config) *string { return &c.TLSClientCAFile }),
+	newField("server.tls.client_auth", "TLS_CLIENT_AUTH", func(c *Config) *string { return &c.TLSClientAuth }, parseLower),
+	listField("server.tls.client_scopes", "TLS_CLIENT_SCOPES", func(c *Config) *[]string { return &c.TLSClientScopes }),
+	reloadable(listField("server.cors.allowed_origins", "CORS_ALLOWED_ORIGINS", func(c *Config) *[]string { return &c.CORSAllowedOrigins })),
+	reloadable(boolField("server.cors.allow_credentials", "CORS_ALLOW_CREDENTIALS", func(c *Config) *bool { return &c.CORSAllowCredentials })),
+	reloadable(durationField("server.cors.max_age", "CORS_MAX_AGE", func(c *Config) *time.Duration { return &c.CORSMaxAge })),
+	stringField("server.headers.content_security_policy", "CONTENT_SECURITY_POLICY", func(c *Config) *string { return &c.ContentSecurityPolicy }),
+	stringField("server.headers.permissions_policy", "PERMISSIONS_POLICY", func(c *Config) *string { return &c.PermissionsPolicy }),
+	stringField("server.headers.cross_origin_resource_policy", "CROSS_ORIGIN_RESOURCE_POLICY", func(c *Config) *string { return &c.CrossOriginResourcePolicy }),
+	durationField("server.headers.hsts_max_age", "HSTS_MAX_AGE", func(c *Config) *time.Duration { return &c.HSTSMaxAge }),
+
+	// Upstream providers
+	reloadable(secret(stringField("providers.openweathermap.api_key", "OPENWEATHERMAP_API_KEY", func(c *Config) *string { return &c.OpenWeatherMapAPIKey }))),
+	reloadable(secret(listField("providers.openweathermap.api_keys", "OPENWEATHERMAP_API_KEYS", func(c *Config) *[]string { return &c.OpenWeatherMapAPIKeys }))),
+	reloadable(newField("providers.openweathermap.key_rotation", "OPENWEATHERMAP_KEY_ROTATION", func(c *Config) *string { return &c.KeyRotation }, parseLower)),
+	newField("providers.openweathermap.key_daily_quota", "OPENWEATHERMAP_KEY_DAILY_QUOTA", func(c *Config) *int { return &c.KeyDailyQuota }, parseInt),
+	durationField("providers.openweathermap.key_bench_duration", "OPENWEATHERMAP_KEY_BENCH_DURATION", func(c *Config) *time.Duration { return &c.KeyBenchDuration }),
+	boolField("providers.allow_caller_keys", "ALLOW_CALLER_KEYS", func(c *Config) *bool { return &c.AllowCallerKeys }),
+
+	// In-memory cache of watched locations
+	{
+		key: "cache.watched_locations", env: "WATCHED_LOCATIONS", sep: ";",
+		set: func(c *Config, value string) error {
+			c.WatchedLocations = parseWatchedLocations(value, 0)
+			return nil
+		},
+		get: func(c *Config) string {
+			entries := make([]string, len(c.WatchedLocations))
+			for i, watched := range c.WatchedLocations {
+				entries[i] = watched.Location + "@" + watched.Units + "=" + watched.Interval.String()
+			}
+			return strings.Join(entries, ";")
+		},
+		copy: func(dst, src *Config) { dst.WatchedLocations = src.WatchedLocations },
+	},
+	durationField("cache.watch_interval", "WATCH_INTERVAL", func(c *Config) *time.Duration { return &c.WatchInterval }),
+	newField("cache.watch_concurrency", "WATCH_CONCURRENCY", func(c *Config) *int { return &c.WatchConcurrency }, parseInt),
+
+	// Observation history
+	stringField("observations.db_path", "OBSERVATIONS_DB_PATH", func(c *Config) *string { return &c.ObservationsDBPath }),
+	durationField("observations.retention", "OBSERVATIONS_RETENTION", func(c *Config) *time.Duration { return &c.ObservationsRetention }),
+
+	// Rate limiting
+	reloadable(boolField("rate_limit.enabled", "RATE_LIMIT_ENABLED", func(c *Config) *bool { return &c.RateLimitEnabled })),
+	reloadable(newField("rate_limit.per_minute", "RATE_LIMIT_PER_MINUTE", func(c *Config) *float64 { return &c.RateLimitPerMinute }, parseFloat)),
+	reloadable(newField("rate_limit.burst", "RATE_LIMIT_BURST", func(c *Config) *int { return &c.RateLimitBurst }, parseInt)),
+
+	// Upstream usage accounting
+	stringField("usage.file", "USAGE_FILE", func(c *Config) *string { return &c.UsageFile }),
+	newField("usage.daily_quota", "QUOTA_DAILY", func(c *Config) *int { return &c.DailyQuota }, parseInt),
+	newField("usage.monthly_quota", "QUOTA_MONTHLY", func(c *Config) *int { return &c.MonthlyQuota }, parseInt),
+
+	// Client authentication
+	{
+		key: "auth.api_keys", env: "API_KEYS", sep: ",", secret: true,
+		set: func(c *Config, value string) error {
+			c.APIKeys = parseClientAPIKeys(value)
+			return nil
+		},
+		get: func(c *Config) string {
+			entries := make([]string, len(c.APIKeys))
+			for i, key := range c.APIKeys {
+				entries[i] = key.Owner + ":" + key.Key
+				if len(key.Scopes) > 0 {
+					entries[i] += ":" + strings.Join(key.Scopes, "+")
+				}
+			}
+			return strings.Join(entries, ",")
+		},
+		show: func(c *Config) string {
+			entries := make([]string, len(c.APIKeys))
+			for i, key := range c.APIKeys {
+				entries[i] = key.Owner + ":" + redact.Secret(key.Key)
+				if len(key.Scopes) > 0 {
+					entries[i] += ":" + strings.Join(key.Scopes, "+")
+				}
+			}
+			return strings.Join(entries, ",")
+		},
+		copy: func(dst, src *Config) { dst.APIKeys = src.APIKeys },
+	},
+	stringField("auth.api_keys_file", "API_KEYS_FILE", func(c *Config) *string { return &c.APIKeysFile }),
+	listField("auth.anonymous_scopes", "AUTH_ANONYMOUS_SCOPES", func(c *Config) *[]string { return &c.AnonymousScopes }),
+	masked(secret(stringField("auth.jwt.hmac_secret", "JWT_HMAC_SECRET", func(c *Config) *string { return &c.JWTSecret }))),
+	stringField("auth.jwt.public_key_file", "JWT_PUBLIC_KEY_FILE", func(c *Config) *string { return &c.JWTPublicKeyFile }),
+	stringField("auth.jwt.jwks_file", "JWT_JWKS_FILE", func(c *Config) *string { return &c.JWTJWKSFile }),
+	stringField("auth.jwt.issuer", "JWT_ISSUER", func(c *Config) *string { return &c.JWTIssuer }),
+	stringField("auth.jwt.audience", "JWT_AUDIENCE", func(c *Config) *string { return &c.JWTAudience }),
+	durationField("auth.jwt.leeway", "JWT_LEEWAY", func(c *Config) *time.Duration { return &c.JWTLeeway }),
+
+	// Logging
+	reloadable(stringField("logging.level", "LOG_LEVEL", func(c *Config) *string { return &c.LogLevel })),
+	listField("logging.redact_params", "LOG_REDACT_PARAMS", func(c *Config) *[]string { return &c.RedactParams }),
+
+	// Tracing
+	withEnv(stringField("tracing.endpoint", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", func(c *Config) *string { return &c.TracingEndpoint }), tracingEndpoint),
+	stringField("tracing.service_name", "OTEL_SERVICE_NAME", func(c *Config) *string { return &c.TracingServiceName }),
+	newField("tracing.sample_ratio", "TRACING_SAMPLE_RATIO", func(c *Config) *float64 { return &c.TracingSampleRatio }, parseFloat),
+}
+
+// fieldsByKey indexes fields by their config file key
+var fieldsByKey = func() map[string]*field {
+	index := make(map[string]*field, len(fields))
+	for i := range fields {
+		index[fields[i].key] = &fields[i]
+	}
+	return index
+}()
+
+// newField builds a field that parses its value with parse and stores it through ptr
+func newField[T any](key, env string, ptr func(*Config) *T, parse func(string) (T, error)) field {
+	return field{
+		key: key,
+		env: env,
+		set: func(c *Config, value string) error {
+			parsed, err := parse(value)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = parsed
+			return nil
+		},
+		get:  func(c *Config) string { return formatValue(*ptr(c)) },
+		copy: func(dst, src *Config) { *ptr(dst) = *ptr(src) },
+	}
+}
+
+func stringField(key, env string, ptr func(*Config) *string) field {
+	return newField(key, env, ptr, parseString)
+}
+
+func boolField(key, env string, ptr func(*Config) *bool) field {
+	f := newField(key, env, ptr, parseBool)
+	f.isBool = true
+	return f
+}
+
+func durationField(key, env string, ptr func(*Config) *time.Duration) field {
+	return newField(key, env, ptr, parseDuration)
+}
+
+func listField(key, env string, ptr func(*Config) *[]string) field {
+	f := newField(key, env, ptr, parseList)
+	f.sep = ","
+	return f
+}
+
+// secret marks a field as never displayed in clear and readable from a file named by the
+// <env>_FILE variable, as mounted by Docker and Kubernetes secrets
+func secret(f field) field {
+	f.secret = true
+	f.fromFile = true
+	return f
+}
+
+// masked makes a secret display fully redacted. Signing secrets use it: their last characters
+// would identify nothing an operator needs and only help an attacker guess them.
+func masked(f field) field {
+	get := f.get
+	f.show = func(c *Config) string {
+		if get(c) == "" {
+			return ""
+		}
+		return redact.Mask
+	}
+	return f
+}
+
+// reloadable marks a field as safe to change while the server is running
+func reloadable(f field) field {
+	f.reloadable = true
+	return f
+}
+
+// withEnv replaces a field's environment lookup
+func withEnv(f field, lookup func() string) field {
+	f.envValue = lookup
+	return f
+}
+
+// formatValue renders a field value the way it would be written in the environment
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseString(value string) (string, error) {
+	return strings.TrimSpace(value), nil
+}
+
+func parseLower(value string) (string, error) {
+	return strings.ToLower(strings.TrimSpace(value)), nil
+}
+
+func parseInt(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	return n, nil
+}
+
+func parseInt64(value string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	return n, nil
+}
+
+func parseFloat(value string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	return f, nil
+}
+
+func parseBool(value string) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("%q is not true or false", value)
+	}
+	return b, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a Go duration such as 30s or 5m", value)
+	}
+	return d, nil
+}
+
+// parseList splits a comma-separated value into trimmed, non-empty items
+func parseList(value string) ([]string, error) {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"weathering-with-go/redact"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Sources of a setting's value, from lowest to highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// ConfigFileEnv names the environment variable pointing at the config file; --config takes precedence
+const ConfigFileEnv = "CONFIG_FILE"
+
+// LoadArgs loads configuration in layers, each overriding the one before: built-in defaults, the
+// config file (--config or CONFIG_FILE; YAML or TOML), environment variables, then command-line
+// flags named after the file keys, e.g. --server.port=9090 or --rate_limit.burst 50.
+//
+// Values that cannot be parsed and unknown file keys do not stop loading; they are reported by
+// Validate together with every other problem. The error is only set for malformed command-line
+// arguments, including flag.ErrHelp when usage was requested.
+func LoadArgs(args []string) (*Config, error) {
+	cfg, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range cfg.UpstreamKeys() {
+		log.Printf("Using OpenWeatherMap API key %s", redact.Secret(key))
+	}
+	return cfg, nil
+}
+
+// load builds a Config from every layer without logging, so reloads stay quiet
+func load(args []string) (*Config, error) {
+	flagValues, configFile, printConfig, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if configFile == "" {
+		configFile = os.Getenv(ConfigFileEnv)
+	}
+
+	cfg := defaults()
+	cfg.ConfigFile = configFile
+	cfg.PrintConfig = printConfig
+	cfg.sources = make(map[string]string)
+
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			cfg.loadErrors = append(cfg.loadErrors, &ConfigError{Field: configFile, Message: err.Error()})
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f, ok := fieldsByKey[key]
+			if !ok {
+				cfg.loadErrors = append(cfg.loadErrors, &ConfigError{Field: key, Message: "unknown setting in " + configFile})
+				continue
+			}
+			cfg.apply(f, SourceFile, key, values[key])
+		}
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		value := os.Getenv(f.env)
+		if f.envValue != nil {
+			value = f.envValue()
+		}
+		if value != "" {
+			cfg.apply(f, SourceEnv, f.env, value)
+		}
+		if f.fromFile {
+			cfg.applySecretFile(f, value != "")
+		}
+	}
+
+	for _, fv := range flagValues {
+		cfg.apply(fv.field, SourceFlag, "--"+fv.field.key, fv.value)
+	}
+
+	cfg.resolve()
+	return cfg, nil
+}
+
+// apply sets one field from the given source, recording a parse failure under name (the file
+// key, variable or flag the value came from)
+func (c *Config) apply(f *field, source, name, value string) {
+	if err := f.set(c, value); err != nil {
+		c.loadErrors = append(c.loadErrors, &ConfigError{Field: name, Message: err.Error()})
+		return
+	}
+	c.sources[f.key] = source
+}
+
+// applySecretFile sets a secret field from the file named by its <env>_FILE variable, if set.
+// A file with several lines gives a list field one item per line.
+func (c *Config) applySecretFile(f *field, envSet bool) {
+	fileEnv := f.env + "_FILE"
+	path := os.Getenv(fileEnv)
+	if path == "" {
+		return
+	}
+	if envSet {
+		c.loadErrors = append(c.loadErrors, &ConfigError{Field: fileEnv, Message: "set either " + f.env + " or " + fileEnv + ", not both"})
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.loadErrors = append(c.loadErrors, &ConfigError{Field: fileEnv, Message: "failed to read secret file: " + err.Error()})
+		return
+	}
+	value := strings.TrimSpace(string(data))
+	if f.sep != "" {
+		value = strings.Join(strings.Fields(value), f.sep)
+	}
+	c.apply(f, SourceEnv, fileEnv, value)
+}
+
+// resolve fills in settings that depend on other settings once every layer has been applied
+func (c *Config) resolve() {
+	for i := range c.WatchedLocations {
+		if c.WatchedLocations[i].Interval == 0 {
+			c.WatchedLocations[i].Interval = c.WatchInterval
+		}
+	}
+}
+
+// flagValue is a command-line override of one field
+type flagValue struct {
+	field *field
+	value string
+}
+
+// parseFlags reads --config, --print-config and one flag per field, keeping overrides in
+// command-line order
+func parseFlags(args []string) ([]flagValue, string, bool, error) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	configFile := fs.String("config", "", "config file (YAML or TOML); overrides "+ConfigFileEnv)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with the source of each setting, secrets redacted, and exit")
+
+	var values []flagValue
+	for i := range fields {
+		f := &fields[i]
+		usage := "overrides " + f.env
+		record := func(value string) error {
+			values = append(values, flagValue{field: f, value: value})
+			return nil
+		}
+		if f.isBool {
+			fs.BoolFunc(f.key, usage, record)
+		} else {
+			fs.Func(f.key, usage, record)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return nil, "", false, err
+	}
+	if fs.NArg() > 0 {
+		return nil, "", false, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return values, *configFile, *printConfig, nil
+}
+
+// readConfigFile parses a YAML (.yaml, .yml) or TOML (.toml) file into values keyed by dotted path
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q; use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	values := make(map[string]string)
+	flatten("", doc, values)
+	return values, nil
+}
+
+// flatten walks nested sections, storing each setting under its dotted key. Sequences are joined
+// with the field's separator so they parse like the equivalent environment variable.
+func flatten(prefix string, section map[string]interface{}, out map[string]string) {
+	for name, value := range section {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case []interface{}:
+			sep := ","
+			if f, ok := fieldsByKey[key]; ok && f.sep != "" {
+				sep = f.sep
+			}
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, sep)
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
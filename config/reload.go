@@ -0,0 +1,205 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of events editors and secret mounts produce when saving a file
+const reloadDebounce = 250 * time.Millisecond
+
+// Change is one setting that differs between two configurations
+type Change struct {
+	Key        string // config file key
+	Env        string // environment variable
+	Old        string // previous value; secrets are redacted
+	New        string // new value; secrets are redacted
+	Reloadable bool   // applied without a restart
+}
+
+// Diff lists the settings that differ from old to new, in registry order
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	for i := range fields {
+		f := &fields[i]
+		if f.get(old) == f.get(new) {
+			continue
+		}
+		changes = append(changes, Change{Key: f.key, Env: f.env, Old: f.display(old), New: f.display(new), Reloadable: f.reloadable})
+	}
+	return changes
+}
+
+// Reloader reloads configuration when the config file changes or SIGHUP arrives. A new
+// configuration must pass Validate; its reloadable settings (CORS, rate limits and the log
+// level) are then swapped in and passed to apply, while changes to other settings are logged
+// as needing a restart. Invalid configurations are rejected and the running one is kept.
+type Reloader struct {
+	args       []string
+	configFile string
+	apply      func(*Config)
+	logger     *slog.Logger
+
+	mu      sync.Mutex
+	current *Config
+
+	watcher *fsnotify.Watcher
+	signals chan os.Signal
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewReloader starts watching for changes to current, which was loaded from args. apply is
+// called with each accepted configuration, which replaces current; it must not modify it.
+func NewReloader(args []string, current *Config, logger *slog.Logger, apply func(*Config)) (*Reloader, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	r := &Reloader{
+		args:       args,
+		configFile: filepath.Clean(current.ConfigFile),
+		apply:      apply,
+		logger:     logger,
+		current:    current,
+		signals:    make(chan os.Signal, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	if current.ConfigFile != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		// Watch the directory rather than the file, since editors and Kubernetes ConfigMap
+		// updates replace the file instead of writing to it
+		if err := watcher.Add(filepath.Dir(r.configFile)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		r.watcher = watcher
+	}
+
+	signal.Notify(r.signals, syscall.SIGHUP)
+	go r.watch()
+	return r, nil
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads and validates the configuration again, applying it if it is valid. It returns
+// the changes found, or the validation error when the new configuration was rejected.
+func (r *Reloader) Reload() ([]Change, error) {
+	next, err := load(r.args)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := Diff(r.current, next)
+	applied := *r.current
+	applied.sources = make(map[string]string, len(r.current.sources))
+	for key, source := range r.current.sources {
+		applied.sources[key] = source
+	}
+	reloaded := false
+	for i := range fields {
+		if f := &fields[i]; f.reloadable && f.get(r.current) != f.get(next) {
+			f.copy(&applied, next)
+			applied.sources[f.key] = next.sources[f.key]
+			reloaded = true
+		}
+	}
+	if reloaded {
+		r.current = &applied
+		r.apply(r.current)
+	}
+	return changes, nil
+}
+
+// Close stops watching for changes
+func (r *Reloader) Close() {
+	r.once.Do(func() {
+		signal.Stop(r.signals)
+		close(r.stop)
+		<-r.done
+		if r.watcher != nil {
+			r.watcher.Close()
+		}
+	})
+}
+
+// watch reloads on SIGHUP and, after a short quiet period, on changes to the config file
+func (r *Reloader) watch() {
+	defer close(r.done)
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if r.watcher != nil {
+		events, watchErrors = r.watcher.Events, r.watcher.Errors
+	}
+
+	debounce := time.NewTimer(0)
+	<-debounce.C
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-r.signals:
+			r.logger.Info("received SIGHUP; reloading configuration")
+			r.reload()
+		case event := <-events:
+			// Kubernetes swaps a ..data symlink when a mounted ConfigMap changes
+			if filepath.Clean(event.Name) == r.configFile || filepath.Base(event.Name) == "..data" {
+				debounce.Reset(reloadDebounce)
+			}
+		case err := <-watchErrors:
+			r.logger.Warn("config file watch failed", "error", err)
+		case <-debounce.C:
+			r.logger.Info("config file changed; reloading configuration", "file", r.configFile)
+			r.reload()
+		}
+	}
+}
+
+// reload reloads the configuration, logging the outcome and every changed setting
+func (r *Reloader) reload() {
+	changes, err := r.Reload()
+	if err != nil {
+		r.logger.Error("rejected configuration reload; keeping the running configuration", "error", err)
+		return
+	}
+	if len(changes) == 0 {
+		r.logger.Info("configuration unchanged")
+		return
+	}
+
+	for _, change := range changes {
+		if change.Reloadable {
+			r.logger.Info("configuration changed", "setting", change.Key, "old", change.Old, "new", change.New)
+		} else {
+			r.logger.Warn("configuration change needs a restart to take effect", "setting", change.Key, "old", change.Old, "new", change.New)
+		}
+	}
+}
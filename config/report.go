@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+
+	"weathering-with-go/redact"
+)
+
+// Setting is one effective setting and where its value came from
+type Setting struct {
+	Key        string `json:"key"`
+	Env        string `json:"env"`
+	Value      string `json:"value"` // secrets are redacted
+	Source     string `json:"source"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+// Report is the effective configuration as shown by /admin/config and --print-config
+type Report struct {
+	ConfigFile string    `json:"config_file,omitempty"`
+	Settings   []Setting `json:"settings"`
+}
+
+// Report lists every setting with its value and source (default, file, env or flag), in
+// config file order. API keys keep only their last four characters; signing secrets are fully masked.
+func (c *Config) Report() Report {
+	settings := make([]Setting, 0, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		source := c.sources[f.key]
+		if source == "" {
+			source = SourceDefault
+		}
+		settings = append(settings, Setting{
+			Key:        f.key,
+			Env:        f.env,
+			Value:      f.display(c),
+			Source:     source,
+			Reloadable: f.reloadable,
+		})
+	}
+	return Report{ConfigFile: c.ConfigFile, Settings: settings}
+}
+
+// display formats a field's value for people, redacting each item of a secret unless the
+// field knows which parts are secret
+func (f *field) display(c *Config) string {
+	if f.show != nil {
+		return f.show(c)
+	}
+	value := f.get(c)
+	if !f.secret || value == "" {
+		return value
+	}
+	if f.sep == "" {
+		return redact.Secret(value)
+	}
+
+	items := strings.Split(value, f.sep)
+	for i, item := range items {
+		items[i] = redact.Secret(item)
+	}
+	return strings.Join(items, f.sep)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+
+	"weathering-with-go/config"
+	"weathering-with-go/services"
+	"weathering-with-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigSource provides the configuration currently in effect, such as a config.Reloader
+type ConfigSource interface {
+	Current() *config.Config
+}
+
+// AdminHandler handles operational endpoints for running the service
+type AdminHandler struct {
+	weatherService *services.WeatherService
+	configSource   ConfigSource
+}
+
+// NewAdminHandler creates a new admin handler instance; configSource may be nil
+func NewAdminHandler(weatherService *services.WeatherService, configSource ConfigSource) *AdminHandler {
+	return &AdminHandler{
+		weatherService: weatherService,
+		configSource:   configSource,
+	}
+}
+
+// GetConfig handles GET /admin/config requests with the effective configuration, the source of
+// each setting and secrets redacted
+func (h *AdminHandler) GetConfig(c *gin.Context) {
+	if h.configSource == nil {
+		utils.SendError(c, utils.NewAPIError(http.StatusNotFound, "Configuration is not available"))
+		return
+	}
+
+	utils.SendSuccess(c, h.configSource.Current().Report())
+}
+
+// ListWatched handles GET /admin/watched requests
+func (h *AdminHandler) ListWatched(c *gin.Context) {
+	poller := h.weatherService.Poller
+	if poller == nil {
+		utils.SendSuccess(c, gin.H{"enabled": false, "locations": []services.WatchStatus{}})
+		return
+	}
+
+	utils.SendSuccess(c, gin.H{"enabled": true, "locations": poller.Statuses()})
+}
+
+// GetWatched handles GET /admin/watched/:location requests
+func (h *AdminHandler) GetWatched(c *gin.Context) {
+	location := c.Param("location")
+	units := c.DefaultQuery("units", "metric")
+
+	poller := h.weatherService.Poller
+	if poller == nil {
+		utils.SendError(c, utils.NewAPIError(http.StatusNotFound, "Location is not watched", "Background polling is disabled"))
+		return
+	}
+
+	status, ok := poller.Status(location, units)
+	if !ok {
+		utils.SendError(c, utils.NewAPIError(http.StatusNotFound, "Location is not watched"))
+		return
+	}
+
+	utils.SendSuccess(c, status)
+}
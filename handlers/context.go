@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"context"
+
+	"weathering-with-go/middleware"
+	"weathering-with-go/services"
+	"weathering-with-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestContext returns the request's context carrying the caller's identity for upstream
+// accounting, the request ID for upstream calls, a CallInfo the access log reads back and,
+// in bring-your-own-key mode, the caller's OpenWeatherMap key
+func requestContext(c *gin.Context) context.Context {
+	ctx := services.WithClientID(c.Request.Context(), middleware.ClientID(c))
+	ctx = services.WithRequestID(ctx, c.GetString(utils.RequestIDKey))
+	ctx, info := services.WithCallInfo(ctx)
+	c.Set(middleware.CallInfoContextKey, info)
+	if key := c.GetString(middleware.UpstreamKeyContextKey); key != "" {
+		ctx = services.WithUpstreamKey(ctx, key)
+	}
+	return ctx
+}
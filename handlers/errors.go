@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"weathering-with-go/services"
+	"weathering-with-go/utils"
+)
+
+// weatherAPIError maps an error from the weather service to the API error sent to the client
+func weatherAPIError(err error) error {
+	errMsg := err.Error()
+
+	// Check for common API errors
+	var statusErr *services.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized:
+			return utils.NewAPIError(http.StatusUnauthorized, "Invalid API key", "Please check your OpenWeatherMap API key")
+		case http.StatusNotFound:
+			return utils.NewAPIError(http.StatusNotFound, "Location not found", "The specified location could not be found")
+		case http.StatusTooManyRequests:
+			return utils.NewAPIError(http.StatusTooManyRequests, "Rate limit exceeded", "Please try again later")
+		}
+	}
+
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return utils.NewAPIError(http.StatusTooManyRequests, "Quota exceeded", errMsg)
+	}
+
+	if errors.Is(err, services.ErrNoUpstreamKeys) {
+		return utils.NewAPIError(http.StatusServiceUnavailable, "Weather service temporarily unavailable", "Please try again later")
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return utils.NewAPIError(http.StatusGatewayTimeout, "Weather service did not respond in time", "Please try again later")
+	}
+
+	if strings.Contains(errMsg, "timeout") || strings.Contains(errMsg, "connection") {
+		return utils.NewAPIError(http.StatusServiceUnavailable, "Weather service temporarily unavailable", "Please try again later")
+	}
+
+	// Default to internal server error
+	return utils.NewAPIError(http.StatusInternalServerError, "Weather service error", errMsg)
+}
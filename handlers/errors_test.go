@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"weathering-with-go/services"
+	"weathering-with-go/utils"
+)
+
+func TestWeatherAPIErrorQuota(t *testing.T) {
+	err := weatherAPIError(fmt.Errorf("daily %w for ip:203.0.113.7", services.ErrQuotaExceeded))
+	if apiErr, ok := err.(*utils.APIError); !ok || apiErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for a wrapped quota error, got %v", err)
+	}
+
+	err = weatherAPIError(fmt.Errorf("API request failed with status 500: quota exceeded upstream"))
+	if apiErr, ok := err.(*utils.APIError); !ok || apiErr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected upstream wording not to be taken for our quota, got %v", err)
+	}
+}
+
+func TestWeatherAPIErrorStatus(t *testing.T) {
+	err := weatherAPIError(fmt.Errorf("current weather: %w", &services.StatusError{StatusCode: http.StatusUnauthorized, Body: "invalid key"}))
+	if apiErr, ok := err.(*utils.APIError); !ok || apiErr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrapped upstream 401, got %v", err)
+	}
+
+	err = weatherAPIError(errors.New("lookup failed: status 404 in body text"))
+	if apiErr, ok := err.(*utils.APIError); !ok || apiErr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a plain error mentioning a status not to be mapped, got %v", err)
+	}
+}
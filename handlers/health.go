@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"weathering-with-go/buildinfo"
+	"weathering-with-go/middleware"
+	"weathering-with-go/models"
+	"weathering-with-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceName identifies the service in health reports
+const ServiceName = "weathering-with-go"
+
+// startedAt is when the process started serving, for uptime reporting
+var startedAt = time.Now()
+
+// HealthHandler handles liveness and readiness probes and build information
+type HealthHandler struct {
+	weatherService *services.WeatherService
+}
+
+// NewHealthHandler creates a new health handler instance
+func NewHealthHandler(weatherService *services.WeatherService) *HealthHandler {
+	return &HealthHandler{
+		weatherService: weatherService,
+	}
+}
+
+// Livez handles GET /livez (and the legacy /health) requests. It reports that the process is
+// up and serving without checking any dependency, so a failing upstream never restarts it.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, newHealthReport("alive"))
+}
+
+// Readyz handles GET /readyz requests. It checks configuration, upstream reachability and local
+// stores, and answers 503 when any of them has failed so load balancers stop routing traffic here.
+// A degraded component, such as an unreachable provider, is reported with status "degraded"
+// while the instance stays in rotation.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	components, ready := h.weatherService.Readiness(c.Request.Context())
+
+	status, code := "ready", http.StatusOK
+	for _, component := range components {
+		if component.Status == services.HealthDegraded {
+			status = "degraded"
+		}
+	}
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	report := newHealthReport(status)
+	report.Components = components
+	c.JSON(code, report)
+}
+
+// Version handles GET /version requests, reporting the build of the running binary. The linked
+// modules are listed only for callers with the admin scope, since they tell an attacker exactly
+// which known vulnerabilities to try.
+func (h *HealthHandler) Version(c *gin.Context) {
+	info := buildinfo.Get()
+	if !middleware.HasScope(c, middleware.ScopeAdmin) {
+		info.Deps = nil
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// newHealthReport builds a report with the service's identity, uptime and the current time
+func newHealthReport(status string) models.HealthReport {
+	build := buildinfo.Get()
+	uptime := time.Since(startedAt)
+	return models.HealthReport{
+		Status:        status,
+		Service:       ServiceName,
+		Version:       build.Version,
+		Commit:        build.Commit,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		Timestamp:     time.Now().UTC(),
+	}
+}
@@ -2,46 +2,86 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"weathering-with-go/buildinfo"
+	"weathering-with-go/metrics"
+	"weathering-with-go/middleware"
 	"weathering-with-go/services"
 )
 
-// SetupRoutes configures all the API routes
-func SetupRoutes(router *gin.Engine, weatherService *services.WeatherService) {
+// SetupRoutes configures all the API routes; configSource backs /admin/config and may be nil
+func SetupRoutes(router *gin.Engine, weatherService *services.WeatherService, configSource ConfigSource) {
 	// Create handlers
 	weatherHandler := NewWeatherHandler(weatherService)
+	adminHandler := NewAdminHandler(weatherService, configSource)
+	healthHandler := NewHealthHandler(weatherService)
 
 	// API version group
 	v1 := router.Group("/api/v1")
 	{
 		// Weather routes
-		weather := v1.Group("/weather")
+		weather := v1.Group("/weather", middleware.RequireScopes(middleware.ScopeWeatherRead))
 		{
 			// GET routes
 			weather.GET("/current", weatherHandler.GetCurrentWeather)
 			weather.GET("/forecast", weatherHandler.GetWeatherForecast)
+			weather.GET("/history", weatherHandler.GetWeatherHistory)
+			weather.GET("/compare", weatherHandler.GetWeatherComparison)
 			
 			// POST routes (for JSON body requests)
 			weather.POST("/current", weatherHandler.PostCurrentWeather)
 			weather.POST("/forecast", weatherHandler.PostWeatherForecast)
+			weather.POST("/batch", weatherHandler.PostWeatherBatch)
 		}
 
+		// Stored observation history
+		v1.GET("/observations", middleware.RequireScopes(middleware.ScopeWeatherRead), weatherHandler.GetObservations)
+
+		// Upstream usage of the calling client
+		v1.GET("/usage", middleware.RequireScopes(middleware.ScopeWeatherRead), weatherHandler.GetUsage)
+
 		// Health check
-		v1.GET("/health", weatherHandler.HealthCheck)
+		v1.GET("/health", healthHandler.Livez)
 	}
 
-	// Root health check
-	router.GET("/health", weatherHandler.HealthCheck)
+	// Admin routes
+	admin := router.Group("/admin", middleware.RequireScopes(middleware.ScopeAdmin))
+	{
+		admin.GET("/watched", adminHandler.ListWatched)
+		admin.GET("/watched/:location", adminHandler.GetWatched)
+		admin.GET("/config", adminHandler.GetConfig)
+	}
+
+	// Prometheus metrics
+	router.GET("/metrics", middleware.RequireScopes(middleware.ScopeMetrics), gin.WrapH(metrics.Handler()))
+
+	// Liveness and readiness probes; /health is kept as an alias of /livez
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/health", healthHandler.Livez)
+
+	// Build information
+	router.GET("/version", healthHandler.Version)
 	
 	// Root endpoint for API info
 	router.GET("/", func(c *gin.Context) {
+		build := buildinfo.Get()
 		c.JSON(200, gin.H{
 			"message":     "Welcome to Weathering with Go API",
-			"version":     "v1.0.0",
+			"version":     build.Version,
+			"commit":      build.Commit,
 			"description": "A simple weather API built with Go and Gin",
 			"endpoints": gin.H{
 				"health":           "/health",
+				"livez":            "/livez",
+				"readyz":           "/readyz",
+				"version":          "/version",
+				"metrics":          "/metrics",
 				"current_weather":  "/api/v1/weather/current?location={location}&units={units}",
 				"weather_forecast": "/api/v1/weather/forecast?location={location}&units={units}&days={days}",
+				"usage":            "/api/v1/usage",
+				"weather_history":  "/api/v1/weather/history?location={location}&start={YYYY-MM-DD}&end={YYYY-MM-DD}&interval={daily|hourly}&units={units}",
+				"weather_compare":  "/api/v1/weather/compare?location={location}&location={location}&units={units}&days={days}",
+				"observations":     "/api/v1/observations?location={location}&units={units}&from={time}&to={time}",
 			},
 			"docs": "https://github.com/tea-LZL/weathering-with-go",
 		})
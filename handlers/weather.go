@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"weathering-with-go/middleware"
 	"weathering-with-go/models"
 	"weathering-with-go/services"
 	"weathering-with-go/utils"
@@ -37,11 +41,9 @@ func (h *WeatherHandler) GetCurrentWeather(c *gin.Context) {
 		return
 	}
 
-	apikey := c.DefaultQuery("key", "")
-
-	weatherData, err := h.weatherService.GetCurrentWeather(location, units, apikey)
+	weatherData, err := h.weatherService.GetCurrentWeather(requestContext(c), location, units)
 	if err != nil {
-		utils.SendError(c, utils.HandleWeatherAPIError(err))
+		utils.SendError(c, weatherAPIError(err))
 		return
 	}
 
@@ -74,9 +76,9 @@ func (h *WeatherHandler) GetWeatherForecast(c *gin.Context) {
 		return
 	}
 
-	weatherData, err := h.weatherService.GetWeatherForecast(location, units, days)
+	weatherData, err := h.weatherService.GetWeatherForecast(requestContext(c), location, units, days)
 	if err != nil {
-		utils.SendError(c, utils.HandleWeatherAPIError(err))
+		utils.SendError(c, weatherAPIError(err))
 		return
 	}
 
@@ -87,7 +89,7 @@ func (h *WeatherHandler) GetWeatherForecast(c *gin.Context) {
 func (h *WeatherHandler) PostCurrentWeather(c *gin.Context) {
 	var req models.WeatherRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, utils.NewAPIError(http.StatusBadRequest, "Invalid request body", err.Error()))
+		utils.SendError(c, utils.BindError(err))
 		return
 	}
 
@@ -106,11 +108,9 @@ func (h *WeatherHandler) PostCurrentWeather(c *gin.Context) {
 		return
 	}
 
-	keys := req.Keys
-
-	weatherData, err := h.weatherService.GetCurrentWeather(req.Location, units, keys)
+	weatherData, err := h.weatherService.GetCurrentWeather(requestContext(c), req.Location, units)
 	if err != nil {
-		utils.SendError(c, utils.HandleWeatherAPIError(err))
+		utils.SendError(c, weatherAPIError(err))
 		return
 	}
 
@@ -121,7 +121,7 @@ func (h *WeatherHandler) PostCurrentWeather(c *gin.Context) {
 func (h *WeatherHandler) PostWeatherForecast(c *gin.Context) {
 	var req models.WeatherRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.SendError(c, utils.NewAPIError(http.StatusBadRequest, "Invalid request body", err.Error()))
+		utils.SendError(c, utils.BindError(err))
 		return
 	}
 
@@ -150,21 +150,207 @@ func (h *WeatherHandler) PostWeatherForecast(c *gin.Context) {
 		return
 	}
 
-	weatherData, err := h.weatherService.GetWeatherForecast(req.Location, units, days)
+	weatherData, err := h.weatherService.GetWeatherForecast(requestContext(c), req.Location, units, days)
+	if err != nil {
+		utils.SendError(c, weatherAPIError(err))
+		return
+	}
+
+	utils.SendSuccess(c, weatherData)
+}
+
+// PostWeatherBatch handles POST /weather/batch requests with a JSON list of locations
+func (h *WeatherHandler) PostWeatherBatch(c *gin.Context) {
+	var req models.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.SendError(c, utils.BindError(err))
+		return
+	}
+
+	batchType := req.Type
+	if batchType == "" {
+		batchType = services.BatchTypeCurrent
+	}
+
+	if err := utils.ValidateBatch(batchType, len(req.Items)); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	// Validate every item up front; only valid items are sent upstream
+	results := make([]models.BatchResult, len(req.Items))
+	valid := make([]models.WeatherRequest, 0, len(req.Items))
+	positions := make([]int, 0, len(req.Items))
+	for i, item := range req.Items {
+		results[i] = models.BatchResult{Index: i, Location: item.Location}
+
+		if item.Units == "" {
+			item.Units = "metric"
+		}
+		if batchType == services.BatchTypeForecast && item.Days == 0 {
+			item.Days = 5
+		}
+
+		err := utils.ValidateLocation(item.Location)
+		if err == nil {
+			err = utils.ValidateUnits(item.Units)
+		}
+		if err == nil && batchType == services.BatchTypeForecast {
+			err = utils.ValidateDays(item.Days)
+		}
+		if err != nil {
+			results[i].Error = utils.ToErrorResponse(err)
+			continue
+		}
+
+		valid = append(valid, item)
+		positions = append(positions, i)
+	}
+
+	ctx, cancel := context.WithTimeout(requestContext(c), services.DefaultBatchTimeout)
+	defer cancel()
+
+	outcomes := h.weatherService.GetBatch(ctx, batchType, valid, services.DefaultBatchConcurrency)
+	for i, outcome := range outcomes {
+		result := &results[positions[i]]
+		if outcome.Err != nil {
+			result.Error = utils.ToErrorResponse(weatherAPIError(outcome.Err))
+			continue
+		}
+		result.Success = true
+		result.Data = outcome.Data
+	}
+
+	response := models.BatchResponse{Type: batchType, Results: results}
+	for _, result := range results {
+		if result.Success {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	utils.SendSuccess(c, response)
+}
+
+// GetWeatherComparison handles GET /weather/compare requests
+func (h *WeatherHandler) GetWeatherComparison(c *gin.Context) {
+	// Accept both repeated parameters (location=A&location=B) and one semicolon-separated list
+	var locations []string
+	for _, value := range c.QueryArray("location") {
+		for _, location := range strings.Split(value, ";") {
+			if location = strings.TrimSpace(location); location != "" {
+				locations = append(locations, location)
+			}
+		}
+	}
+
+	if err := utils.ValidateCompareLocations(locations); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	units := c.DefaultQuery("units", "metric")
+	if err := utils.ValidateUnits(units); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	daysStr := c.DefaultQuery("days", "5")
+	days, err := strconv.Atoi(daysStr)
+	if err != nil {
+		utils.SendError(c, utils.NewAPIError(http.StatusBadRequest, "Invalid days parameter", "Must be a valid number"))
+		return
+	}
+
+	if err := utils.ValidateDays(days); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	comparison, err := h.weatherService.CompareLocations(requestContext(c), locations, units, days)
+	if err != nil {
+		utils.SendError(c, weatherAPIError(err))
+		return
+	}
+
+	utils.SendSuccess(c, comparison)
+}
+
+// GetWeatherHistory handles GET /weather/history requests
+func (h *WeatherHandler) GetWeatherHistory(c *gin.Context) {
+	location := c.Query("location")
+	if err := utils.ValidateLocation(location); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	units := c.DefaultQuery("units", "metric")
+	if err := utils.ValidateUnits(units); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "daily")
+	if err := utils.ValidateInterval(interval); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	start, end, err := utils.ValidateDateRange(c.Query("start"), c.Query("end"), interval)
 	if err != nil {
-		utils.SendError(c, utils.HandleWeatherAPIError(err))
+		utils.SendError(c, err)
+		return
+	}
+
+	weatherData, err := h.weatherService.GetWeatherHistory(requestContext(c), location, units, start, end, interval)
+	if err != nil {
+		utils.SendError(c, weatherAPIError(err))
 		return
 	}
 
 	utils.SendSuccess(c, weatherData)
 }
 
-// HealthCheck handles GET /health requests
-func (h *WeatherHandler) HealthCheck(c *gin.Context) {
-	response := gin.H{
-		"status":    "healthy",
-		"service":   "weathering-with-go",
-		"timestamp": gin.H{"unix": gin.H{}},
+// GetObservations handles GET /observations requests
+func (h *WeatherHandler) GetObservations(c *gin.Context) {
+	location := c.Query("location")
+	if err := utils.ValidateLocation(location); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	units := c.DefaultQuery("units", "metric")
+	if err := utils.ValidateUnits(units); err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	from, to, err := utils.ValidateTimeRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		utils.SendError(c, err)
+		return
 	}
-	c.JSON(http.StatusOK, response)
+
+	series, err := h.weatherService.GetObservations(location, units, from, to)
+	if errors.Is(err, services.ErrObservationsDisabled) {
+		utils.SendError(c, utils.NewAPIError(http.StatusServiceUnavailable, "Observation history is disabled", "Set OBSERVATIONS_DB_PATH to enable it"))
+		return
+	}
+	if err != nil {
+		utils.SendError(c, err)
+		return
+	}
+
+	utils.SendSuccess(c, series)
+}
+
+// GetUsage handles GET /usage requests, reporting the caller's upstream consumption
+func (h *WeatherHandler) GetUsage(c *gin.Context) {
+	if h.weatherService.Usage == nil {
+		utils.SendError(c, utils.NewAPIError(http.StatusServiceUnavailable, "Usage accounting is disabled"))
+		return
+	}
+
+	utils.SendSuccess(c, h.weatherService.Usage.Usage(middleware.ClientID(c)))
 }
@@ -1,15 +1,23 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"weathering-with-go/buildinfo"
+	"weathering-with-go/config"
+	"weathering-with-go/metrics"
+	"weathering-with-go/middleware"
+	"weathering-with-go/models"
 	"weathering-with-go/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // transportRedirect rewrites requests to point to the test server URL
@@ -48,6 +56,9 @@ func TestGetCurrentWeatherHandler(t *testing.T) {
 	wh := NewWeatherHandler(svc)
 	router.GET("/api/v1/weather/current", wh.GetCurrentWeather)
 
+	upstream := metrics.UpstreamRequests.WithLabelValues(services.ProviderOpenWeatherMap, "weather", "200")
+	before := testutil.ToFloat64(upstream)
+
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Testville&units=metric", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -55,4 +66,394 @@ func TestGetCurrentWeatherHandler(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 OK got %d body=%s", w.Code, w.Body.String())
 	}
+	if got := testutil.ToFloat64(upstream) - before; got != 1 {
+		t.Fatalf("expected one upstream call to be counted, got %v", got)
+	}
+}
+
+func TestPostWeatherBatchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "Nowhere" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"cod":"404","message":"city not found"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"weather":[{"main":"Clear"}],"main":{"temp":10.5},"sys":{"country":"GB"},"name":%q,"cod":200}`, r.URL.Query().Get("q"))
+	}))
+	defer srv.Close()
+
+	svc := services.NewWeatherService("dummy")
+	svc.HTTPClient = &http.Client{Transport: &transportRedirect{target: srv.URL}}
+
+	wh := NewWeatherHandler(svc)
+	router.POST("/api/v1/weather/batch", wh.PostWeatherBatch)
+
+	body := `{"items":[{"location":"Testville"},{"location":"X"},{"location":"Nowhere"},{"location":"Otherton","units":"imperial"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/weather/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK got %d body=%s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Data models.BatchResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	results := resp.Data.Results
+	if len(results) != 4 || resp.Data.Succeeded != 2 || resp.Data.Failed != 2 {
+		t.Fatalf("unexpected batch summary: %+v", resp.Data)
+	}
+	if !results[0].Success || results[0].Data.Location.Name != "Testville" {
+		t.Fatalf("expected first item to succeed in order: %+v", results[0])
+	}
+	if results[1].Success || results[1].Error.Code != http.StatusBadRequest {
+		t.Fatalf("expected second item to fail validation: %+v", results[1])
+	}
+	if results[2].Success || results[2].Error.Code != http.StatusNotFound {
+		t.Fatalf("expected third item to be not found: %+v", results[2])
+	}
+	if !results[3].Success || results[3].Data.Location.Name != "Otherton" {
+		t.Fatalf("expected fourth item to succeed in order: %+v", results[3])
+	}
+}
+
+func TestRejectedUpstreamKeysAreBenched(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var appids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appid := r.URL.Query().Get("appid")
+		appids = append(appids, appid)
+		if appid != "good-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"cod":401,"message":"Invalid API key"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"name":"Testville"}`)
+	}))
+	defer srv.Close()
+
+	svc := services.NewWeatherService("revoked-key")
+	svc.Keys = services.NewKeyPool([]string{"revoked-key", "good-key"}, services.RotationRoundRobin, 0, time.Minute)
+	svc.HTTPClient = &http.Client{Transport: &transportRedirect{target: srv.URL}}
+	router := gin.New()
+	router.GET("/api/v1/weather/current", NewWeatherHandler(svc).GetCurrentWeather)
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Testville", nil))
+		codes = append(codes, w.Code)
+	}
+	if fmt.Sprint(codes) != "[401 200 200]" || strings.Join(appids, ",") != "revoked-key,good-key,good-key" {
+		t.Fatalf("expected the revoked key to be benched after one call, got %v with %v", codes, appids)
+	}
+
+	// With every key benched, requests fail without calling upstream
+	svc.Keys.SetKeys([]string{"revoked-key"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Testville", nil))
+	if w.Code != http.StatusServiceUnavailable || len(appids) != 3 {
+		t.Fatalf("expected 503 without an upstream call, got %d after %d calls", w.Code, len(appids))
+	}
+}
+
+// staticConfig is a ConfigSource with a fixed configuration
+type staticConfig struct{ cfg *config.Config }
+
+func (s staticConfig) Current() *config.Config { return s.cfg }
+
+func TestAdminConfigIsRedacted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Port: "8080", OpenWeatherMapAPIKey: "server-secret-key-9876", JWTSecret: "hmac-signing-secret-5432"}
+	router := gin.New()
+	router.GET("/admin/config", NewAdminHandler(services.NewWeatherService("dummy"), staticConfig{cfg}).GetConfig)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "server-secret") || strings.Contains(w.Body.String(), "5432") {
+		t.Fatalf("secret leaked: %s", w.Body.String())
+	}
+
+	var resp struct {
+		Data config.Report `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	for _, setting := range resp.Data.Settings {
+		if setting.Key == "providers.openweathermap.api_key" && setting.Value != "[REDACTED]9876" {
+			t.Fatalf("unexpected key display %q", setting.Value)
+		}
+		if setting.Key == "auth.jwt.hmac_secret" && setting.Value != "[REDACTED]" {
+			t.Fatalf("expected the signing secret to be fully masked, got %q", setting.Value)
+		}
+		if setting.Key == "server.port" && (setting.Value != "8080" || setting.Source != config.SourceDefault) {
+			t.Fatalf("unexpected port setting %+v", setting)
+		}
+	}
+
+	// Without a config source the endpoint is not available
+	router = gin.New()
+	router.GET("/admin/config", NewAdminHandler(services.NewWeatherService("dummy"), nil).GetConfig)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", w.Code)
+	}
+}
+
+func TestCallerKeyComesFromHeaderOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var appids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appids = append(appids, r.URL.Query().Get("appid"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"list":[],"city":{"name":"Testville"},"name":"Testville"}`)
+	}))
+	defer srv.Close()
+
+	svc := services.NewWeatherService("server-key")
+	svc.HTTPClient = &http.Client{Transport: &transportRedirect{target: srv.URL}}
+	wh := NewWeatherHandler(svc)
+
+	router := gin.New()
+	router.Use(middleware.UpstreamKey(true))
+	router.GET("/api/v1/weather/current", wh.GetCurrentWeather)
+	router.GET("/api/v1/weather/forecast", wh.GetWeatherForecast)
+
+	for _, path := range []string{"/api/v1/weather/current?location=Testville&key=query-key", "/api/v1/weather/forecast?location=Testville"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(middleware.UpstreamKeyHeader, "caller-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 OK got %d body=%s", path, w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Testville&key=query-key", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := []string{"caller-key", "caller-key", "server-key"}
+	if strings.Join(appids, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected upstream keys %v got %v", expected, appids)
+	}
+
+	// With bring-your-own-key disabled the header is refused
+	disabled := gin.New()
+	disabled.Use(middleware.UpstreamKey(false))
+	disabled.GET("/api/v1/weather/current", wh.GetCurrentWeather)
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Testville", nil)
+	req.Header.Set(middleware.UpstreamKeyHeader, "caller-key")
+	w := httptest.NewRecorder()
+	disabled.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 with caller keys disabled got %d", w.Code)
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var upstreamIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamIDs = append(upstreamIDs, r.Header.Get("X-Request-ID"))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, `{"cod":"404","message":"city not found"}`)
+	}))
+	defer srv.Close()
+
+	svc := services.NewWeatherService("dummy")
+	svc.HTTPClient = &http.Client{Transport: &transportRedirect{target: srv.URL}}
+	wh := NewWeatherHandler(svc)
+
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	router.GET("/api/v1/weather/current", wh.GetCurrentWeather)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Nowhere", nil)
+	req.Header.Set("X-Request-ID", "client-req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp.Error == nil || resp.Error.RequestID != "client-req-42" {
+		t.Fatalf("expected request ID in error response, got %s", w.Body.String())
+	}
+	if w.Header().Get("X-Request-ID") != "client-req-42" {
+		t.Fatalf("expected request ID header, got %q", w.Header().Get("X-Request-ID"))
+	}
+	if len(upstreamIDs) != 1 || upstreamIDs[0] != "client-req-42" {
+		t.Fatalf("expected request ID on upstream call, got %v", upstreamIDs)
+	}
+}
+
+func TestLivezAndReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	probes := 0
+	upstreamDown := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		if r.URL.Query().Get("appid") == "revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"cod":401,"message":"Invalid API key"}`)
+			return
+		}
+		if upstreamDown {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"weather":[{"main":"Clear"}],"main":{"temp":25},"name":"Globe","cod":200}`)
+	}))
+	defer srv.Close()
+
+	newRouter := func(keys ...string) (*gin.Engine, *services.WeatherService) {
+		svc := services.NewWeatherService("dummy")
+		if len(keys) > 0 {
+			svc.Keys.SetKeys(keys)
+		}
+		svc.HTTPClient = &http.Client{Transport: &transportRedirect{target: srv.URL}}
+		router := gin.New()
+		SetupRoutes(router, svc, nil)
+		return router, svc
+	}
+
+	get := func(router *gin.Engine, path string) (*httptest.ResponseRecorder, models.HealthReport) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report models.HealthReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", path, err)
+		}
+		return w, report
+	}
+
+	router, _ := newRouter()
+	w, live := get(router, "/livez")
+	if w.Code != http.StatusOK || live.Status != "alive" || live.Version != buildinfo.Get().Version {
+		t.Fatalf("unexpected liveness: %d %s", w.Code, w.Body.String())
+	}
+	if time.Since(live.Timestamp) > time.Minute || live.Components != nil {
+		t.Fatalf("expected a real timestamp and no components, got %s", w.Body.String())
+	}
+	if _, legacy := get(router, "/health"); legacy.Status != "alive" {
+		t.Fatalf("expected /health to alias /livez, got %q", legacy.Status)
+	}
+
+	w, ready := get(router, "/readyz")
+	if w.Code != http.StatusOK || ready.Status != "ready" {
+		t.Fatalf("expected ready, got %d %s", w.Code, w.Body.String())
+	}
+	if ready.Components[services.ProviderOpenWeatherMap].Status != services.HealthOK ||
+		ready.Components["observations"].Status != services.HealthDisabled {
+		t.Fatalf("unexpected components: %s", w.Body.String())
+	}
+
+	// The probe result is cached, so repeated checks do not spend upstream calls
+	get(router, "/readyz")
+	if probes != 1 {
+		t.Fatalf("expected one upstream probe, got %d", probes)
+	}
+
+	// A provider outage degrades readiness without taking the instance out of rotation
+	upstreamDown = true
+	router, _ = newRouter()
+	w, ready = get(router, "/readyz")
+	if w.Code != http.StatusOK || ready.Status != "degraded" {
+		t.Fatalf("expected degraded while upstream is down, got %d %s", w.Code, w.Body.String())
+	}
+	if component := ready.Components[services.ProviderOpenWeatherMap]; component.Status != services.HealthDegraded {
+		t.Fatalf("expected the provider to be degraded, got %+v", component)
+	}
+	upstreamDown = false
+
+	// A rejected key is benched; readiness holds while another key is usable
+	router, _ = newRouter("revoked", "valid")
+	w, ready = get(router, "/readyz")
+	if w.Code != http.StatusOK || ready.Components["config"].Status != services.HealthOK {
+		t.Fatalf("expected ready with a usable key left, got %d %s", w.Code, w.Body.String())
+	}
+	if component := ready.Components[services.ProviderOpenWeatherMap]; component.Status != services.HealthDegraded || !strings.Contains(component.Message, "rejected") {
+		t.Fatalf("expected the provider to be degraded, got %+v", component)
+	}
+
+	// A fully benched pool recovers on its own, so it degrades readiness rather than failing it
+	router, _ = newRouter("revoked")
+	w, ready = get(router, "/readyz")
+	if w.Code != http.StatusOK || ready.Status != "degraded" || ready.Components["config"].Status != services.HealthDegraded {
+		t.Fatalf("expected degraded with every key benched, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Only a pool with no keys at all fails readiness
+	router, unconfigured := newRouter()
+	unconfigured.Keys.SetKeys(nil)
+	w, ready = get(router, "/readyz")
+	if w.Code != http.StatusServiceUnavailable || ready.Components["config"].Status != services.HealthFail {
+		t.Fatalf("expected not ready with no key configured, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Readiness fails once shutdown starts, while liveness is unaffected
+	router, svc := newRouter()
+	svc.StartDraining()
+
+	w, ready = get(router, "/readyz")
+	if w.Code != http.StatusServiceUnavailable || ready.Components["server"].Status != services.HealthFail {
+		t.Fatalf("expected not ready while draining, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := get(router, "/livez"); w.Code != http.StatusOK {
+		t.Fatalf("expected liveness while draining, got %d", w.Code)
+	}
+}
+
+func TestVersionHidesDepsFromNonAdmins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	get := func(anonymousScopes ...string) map[string]any {
+		router := gin.New()
+		router.Use(middleware.AnonymousScopes(anonymousScopes))
+		router.GET("/version", NewHealthHandler(services.NewWeatherService("dummy")).Version)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("unexpected response: %d %s", w.Code, w.Body.String())
+		}
+		return body
+	}
+
+	public := get(middleware.ScopeWeatherRead)
+	if _, ok := public["deps"]; ok {
+		t.Fatalf("deps shown without the admin scope: %v", public)
+	}
+	if public["version"] != buildinfo.Get().Version {
+		t.Fatalf("expected the version to stay public, got %v", public)
+	}
+
+	admin := get(middleware.ScopeAdmin)
+	if deps, _ := admin["deps"].([]any); len(deps) != len(buildinfo.Get().Deps) {
+		t.Fatalf("expected %d deps for an admin, got %v", len(buildinfo.Get().Deps), admin["deps"])
+	}
 }
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"weathering-with-go/config"
+)
+
+// Level is the minimum level of the logger installed by Setup; it can be changed at runtime
+var Level = new(slog.LevelVar)
+
+// ParseLevel converts a configured level name (debug, info, warn, error) to a slog level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// New creates a logger writing JSON in production and human-readable text elsewhere
+func New(w io.Writer, environment string, level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if environment == "production" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Setup builds the logger for cfg, installs it as the default (which also routes the standard
+// log package through it) and returns it
+func Setup(cfg *config.Config) *slog.Logger {
+	level, err := ParseLevel(cfg.LogLevel)
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	Level.Set(level)
+
+	logger := New(os.Stderr, cfg.Environment, Level)
+	slog.SetDefault(logger)
+	return logger
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"":        slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	}
+	for name, want := range cases {
+		got, err := ParseLevel(name)
+		if err != nil || got != want {
+			t.Fatalf("ParseLevel(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+}
+
+func TestNewHonoursEnvironmentAndLevel(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+
+	logger := New(&buf, "production", level)
+	logger.Info("dropped")
+	logger.Warn("kept", "location", "Oslo")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON entry, got %q: %v", buf.String(), err)
+	}
+	if entry["msg"] != "kept" || entry["location"] != "Oslo" {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+
+	// Lowering the level takes effect without rebuilding the logger
+	buf.Reset()
+	level.Set(slog.LevelDebug)
+	logger.Debug("now visible")
+	if !strings.Contains(buf.String(), "now visible") {
+		t.Fatalf("expected debug entry after lowering the level, got %q", buf.String())
+	}
+
+	buf.Reset()
+	New(&buf, "development", level).Info("hello", "k", "v")
+	if !strings.Contains(buf.String(), "msg=hello") || !strings.Contains(buf.String(), "k=v") {
+		t.Fatalf("expected text output in development, got %q", buf.String())
+	}
+}
@@ -1,67 +1,328 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"weathering-with-go/buildinfo"
 	"weathering-with-go/config"
 	"weathering-with-go/handlers"
+	"weathering-with-go/logging"
 	"weathering-with-go/middleware"
 	"weathering-with-go/services"
+	"weathering-with-go/store"
+	"weathering-with-go/tlsconfig"
+	"weathering-with-go/tracing"
 
 	"github.com/gin-gonic/gin"
 )
 
+// tracingFlushTimeout bounds how long exiting waits for buffered spans to be exported
+const tracingFlushTimeout = 2 * time.Second
+
 func main() {
-	// Load configuration
-	cfg := config.Load()
+	os.Exit(run())
+}
+
+// run starts the service and blocks until it fails or is told to stop, returning the exit code.
+// Cleanup is deferred so that background workers are stopped and stores flushed in either case.
+func run() int {
+	// Load configuration: defaults, then the config file, environment variables and flags
+	cfg, err := config.LoadArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		log.Printf("Configuration error: %v", err)
+		return 1
+	}
+	if cfg.PrintConfig {
+		return printConfig(cfg)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
-		log.Fatalf("Configuration error: %v", err)
+		log.Printf("Configuration error: %v", err)
+		return 1
+	}
+
+	// Structured logging: JSON in production, text elsewhere, at the configured level
+	logger := logging.Setup(cfg)
+
+	// Distributed tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		return fail(logger, "failed to set up tracing", err)
+	}
+	defer func() {
+		// Flushed last, so spans from the shutdown itself are exported
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("failed to flush traces", "error", err)
+		}
+	}()
+	if cfg.TracingEndpoint != "" {
+		logger.Info("exporting traces", "endpoint", cfg.TracingEndpoint, "sample_ratio", cfg.TracingSampleRatio)
 	}
 
 	// Set gin mode based on environment
 	if cfg.IsProduction() {
-		log.Println("Running in production mode")
+		logger.Info("running in production mode")
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	// Create weather service
 	weatherService := services.NewWeatherService(cfg.OpenWeatherMapAPIKey)
+	weatherService.Logger = logger.With("component", "weather")
+
+	// Rotate among the server's OpenWeatherMap keys, benching any the provider rejects
+	weatherService.Keys = services.NewKeyPool(cfg.UpstreamKeys(), cfg.KeyRotation, cfg.KeyDailyQuota, cfg.KeyBenchDuration)
+	weatherService.Keys.Logger = logger.With("component", "keys")
+	if keys := weatherService.Keys.Len(); keys > 1 {
+		logger.Info("rotating upstream API keys", "keys", keys, "rotation", cfg.KeyRotation, "daily_quota", cfg.KeyDailyQuota)
+	}
 
-	// Create gin router
-	router := gin.Default()
+	// Open observation store
+	if cfg.ObservationsDBPath != "" {
+		observationStore, err := store.NewObservationStore(cfg.ObservationsDBPath, cfg.ObservationsRetention)
+		if err != nil {
+			return fail(logger, "failed to open observation store", err)
+		}
+		defer func() {
+			if err := observationStore.Close(); err != nil {
+				logger.Warn("failed to close observation store", "error", err)
+			}
+		}()
+		weatherService.Observations = observationStore
+		logger.Info("recording observations", "path", cfg.ObservationsDBPath, "retention", cfg.ObservationsRetention.String())
+	}
+
+	// Track upstream usage per client
+	usageTracker, err := services.NewUsageTracker(cfg.UsageFile, cfg.DailyQuota, cfg.MonthlyQuota)
+	if err != nil {
+		return fail(logger, "failed to load usage counters", err)
+	}
+	defer func() {
+		if err := usageTracker.Close(); err != nil {
+			logger.Warn("failed to flush usage counters", "error", err)
+		}
+	}()
+	weatherService.Usage = usageTracker
+
+	// Start background polling of watched locations
+	if len(cfg.WatchedLocations) > 0 {
+		watched := make([]services.WatchedLocation, 0, len(cfg.WatchedLocations))
+		for _, loc := range cfg.WatchedLocations {
+			watched = append(watched, services.WatchedLocation{Location: loc.Location, Units: loc.Units, Interval: loc.Interval})
+		}
+		poller := services.NewPoller(weatherService, watched, cfg.WatchConcurrency)
+		poller.Start()
+		// Stopped before the usage counters and observation store close, since refreshes write to both
+		defer poller.Stop()
+		weatherService.Poller = poller
+		logger.Info("watching locations", "locations", len(watched), "workers", cfg.WatchConcurrency)
+	}
+
+	// Create gin router. X-Forwarded-For is only believed from the configured proxies, so callers
+	// cannot pick a new client IP per request to escape per-client rate limits and quotas.
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fail(logger, "invalid trusted proxies", err)
+	}
+
+	// Load client API keys
+	keyStore, err := middleware.NewKeyStore(cfg)
+	if err != nil {
+		return fail(logger, "failed to load API keys", err)
+	}
+	jwtVerifier, err := middleware.NewJWTVerifier(cfg)
+	if err != nil {
+		return fail(logger, "failed to load JWT keys", err)
+	}
+	if keyStore.Len() == 0 && jwtVerifier == nil && (cfg.TLSClientCAFile == "" || cfg.TLSClientAuth != "require") {
+		logger.Warn("no client authentication configured; anonymous clients have scopes", "scopes", cfg.AnonymousScopes)
+	}
 
 	// Add middleware
-	setupMiddleware(router, cfg)
+	corsPolicy := middleware.NewCORSPolicy(cfg)
+	rateLimiter := middleware.NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+	rateLimiter.SetEnabled(cfg.RateLimitEnabled)
+	setupMiddleware(router, cfg, logger, corsPolicy, rateLimiter, keyStore, jwtVerifier)
+
+	// Apply CORS, rate limit, log level, upstream key and key rotation changes when the config
+	// file changes or SIGHUP arrives
+	reloader, err := config.NewReloader(os.Args[1:], cfg, logger.With("component", "config"), func(next *config.Config) {
+		weatherService.Keys.SetKeys(next.UpstreamKeys())
+		weatherService.Keys.SetStrategy(next.KeyRotation)
+		corsPolicy.Update(next)
+		// New limits first, so enabling the limiter never applies the old ones for a moment
+		rateLimiter.SetLimits(next.RateLimitPerMinute, next.RateLimitBurst)
+		rateLimiter.SetEnabled(next.RateLimitEnabled)
+		if level, err := logging.ParseLevel(next.LogLevel); err == nil {
+			logging.Level.Set(level)
+		}
+	})
+	if err != nil {
+		return fail(logger, "failed to watch configuration", err)
+	}
+	defer reloader.Close()
 
 	// Setup routes
-	handlers.SetupRoutes(router, weatherService)
+	handlers.SetupRoutes(router, weatherService, reloader)
+
+	// Answer CORS preflights with the methods each route actually serves
+	corsPolicy.SetRoutes(router.Routes())
+
+	// Timeouts and header limits so slow or oversized requests cannot tie up connections
+	server := &http.Server{
+		Addr:              cfg.GetServerAddress(),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		Protocols:         serverProtocols(cfg),
+	}
+
+	// HTTPS with certificates reloaded from disk, optionally verifying client certificates
+	if cfg.TLSEnabled() {
+		tlsConfig, reloader, err := tlsconfig.New(cfg, logger.With("component", "tls"))
+		if err != nil {
+			return fail(logger, "failed to load TLS configuration", err)
+		}
+		defer reloader.Close()
+		server.TLSConfig = tlsConfig
+	}
 
 	// Start server
-	log.Printf("Starting server on %s", cfg.GetServerAddress())
-	log.Printf("Environment: %s", cfg.Environment)
-	log.Printf("Log Level: %s", cfg.LogLevel)
+	build := buildinfo.Get()
+	logger.Info("starting server", "address", cfg.GetServerAddress(), "environment", cfg.Environment, "log_level", cfg.LogLevel,
+		"version", build.Version, "commit", build.Commit, "tls", cfg.TLSEnabled(), "mtls", cfg.TLSClientCAFile != "", "h2c", cfg.H2CEnabled)
+
+	return serve(logger, cfg, server, weatherService)
+}
+
+// serve runs the server until it fails or SIGINT/SIGTERM arrives. On a signal, readiness starts
+// failing, new connections are still accepted for the drain delay so load balancers can react,
+// and in-flight requests then get up to the shutdown timeout to finish.
+func serve(logger *slog.Logger, cfg *config.Config, server *http.Server, weatherService *services.WeatherService) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			// Certificates come from TLSConfig.GetCertificate
+			serveErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fail(logger, "server failed", err)
+	case <-ctx.Done():
+	}
+	// Restore default signal handling, so a second signal terminates immediately
+	stop()
+
+	logger.Info("shutting down", "drain_delay", cfg.ShutdownDrainDelay.String(), "timeout", cfg.ShutdownTimeout.String())
+	weatherService.StartDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("in-flight requests did not finish in time; closing connections", "error", err)
+		server.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return fail(logger, "server failed", err)
+	}
+
+	logger.Info("server stopped")
+	return 0
+}
+
+// serverProtocols enables HTTP/1.1 and, over TLS, HTTP/2. With h2c, prior-knowledge HTTP/2 is also
+// accepted on plaintext connections, as sent by proxies that speak HTTP/2 to their backends.
+func serverProtocols(cfg *config.Config) *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(cfg.H2CEnabled)
+	return protocols
+}
+
+// printConfig writes the effective configuration as JSON to stdout, then reports whether it is valid
+func printConfig(cfg *config.Config) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(cfg.Report()); err != nil {
+		log.Printf("failed to print configuration: %v", err)
+		return 1
+	}
 
-	// Start the server (blocking call)
-	if err := router.Run(cfg.GetServerAddress()); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := cfg.Validate(); err != nil {
+		log.Printf("Configuration error: %v", err)
+		return 1
 	}
+	return 0
+}
+
+// fail logs an error and returns the exit code for it
+func fail(logger *slog.Logger, msg string, err error) int {
+	logger.Error(msg, "error", err)
+	return 1
 }
 
 // setupMiddleware configures middleware for the gin router
-func setupMiddleware(router *gin.Engine, cfg *config.Config) {
+func setupMiddleware(router *gin.Engine, cfg *config.Config, logger *slog.Logger, corsPolicy *middleware.CORSPolicy, rateLimiter *middleware.RateLimiter, keyStore *middleware.KeyStore, jwtVerifier *middleware.JWTVerifier) {
+	// Server spans (first, so every later middleware and handler runs inside the request's span)
+	router.Use(middleware.Tracing(cfg.TracingServiceName))
+
+	// Request ID middleware (early, so every response and log line carries the ID)
+	router.Use(middleware.RequestID())
+
+	// Prometheus HTTP metrics
+	router.Use(middleware.Metrics())
+
+	// Structured access log (early, so requests rejected by later middleware are logged too)
+	router.Use(middleware.Logger(logger.With("component", "http"), cfg))
+
 	// Security headers
-	router.Use(middleware.Security())
+	router.Use(middleware.Security(cfg))
 
 	// CORS middleware
-	router.Use(middleware.CORS())
+	router.Use(middleware.CORS(corsPolicy))
 
-	// Request ID middleware
-	router.Use(middleware.RequestID())
+	// Reject oversized request bodies before handlers read them
+	router.Use(middleware.BodyLimit(cfg.MaxBodyBytes))
+
+	// Bring-your-own OpenWeatherMap key (strips the header before anything logs it)
+	router.Use(middleware.UpstreamKey(cfg.AllowCallerKeys))
+
+	// Client authentication: JWT bearer tokens first, then API keys, then TLS client certificates
+	router.Use(middleware.JWTAuth(jwtVerifier))
+	router.Use(middleware.APIKeyAuth(keyStore))
+	router.Use(middleware.ClientCertAuth(cfg))
+	router.Use(middleware.AnonymousScopes(cfg.AnonymousScopes))
 
-	// Logger middleware
-	router.Use(middleware.Logger(cfg))
+	// Per-client rate limiting (after authentication so callers are limited by identity); always
+	// installed so that a reload can enable it
+	router.Use(middleware.RateLimit(rateLimiter))
 
 	// Recovery middleware
 	router.Use(gin.Recovery())
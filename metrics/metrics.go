@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric exported by the service
+const Namespace = "weathering"
+
+// Registry holds the service's collectors plus Go runtime and process statistics.
+// A dedicated registry keeps /metrics free of collectors registered by dependencies.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts handled requests by method, route pattern and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by method, route pattern and status code
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// HTTPInFlight tracks requests currently being handled
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being handled.",
+	})
+
+	// UpstreamRequests counts upstream calls by provider, endpoint and outcome: the HTTP status
+	// code, or "error" when no response was received
+	UpstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "upstream",
+		Name:      "requests_total",
+		Help:      "Upstream provider calls, by provider, endpoint and status code (\"error\" when no response was received).",
+	}, []string{"provider", "endpoint", "status"})
+
+	// UpstreamDuration observes upstream call latency by provider and endpoint
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "upstream",
+		Name:      "request_duration_seconds",
+		Help:      "Upstream provider call latency, by provider and endpoint.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"provider", "endpoint"})
+
+	// UpstreamErrors counts failed upstream calls by provider, endpoint and reason
+	UpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "upstream",
+		Name:      "errors_total",
+		Help:      "Failed upstream provider calls, by provider, endpoint and reason (timeout, transport, status, decode).",
+	}, []string{"provider", "endpoint", "reason"})
+
+	// CacheLookups counts current-weather lookups against the poller's in-memory results
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Current-weather lookups against the background poller's results, by result (hit, miss, bypass).",
+	}, []string{"result"})
+
+	// PollerRefreshes counts background refreshes of watched locations
+	PollerRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "poller",
+		Name:      "refreshes_total",
+		Help:      "Background refreshes of watched locations, by result (success, failure).",
+	}, []string{"result"})
+
+	// RateLimited counts requests rejected by the per-client rate limiter
+	RateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by the per-client rate limiter.",
+	})
+
+	// QuotaRejections counts upstream calls refused because a client's quota was used up
+	QuotaRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "upstream",
+		Name:      "quota_rejections_total",
+		Help:      "Upstream calls refused because the client's quota was used up, by window (daily, monthly).",
+	}, []string{"window"})
+
+	// UpstreamKeyBenches counts upstream API keys taken out of rotation after the provider
+	// rejected (401) or throttled (429) them
+	UpstreamKeyBenches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "upstream",
+		Name:      "key_benches_total",
+		Help:      "Upstream API keys taken out of rotation, by the status that caused it (401, 429).",
+	}, []string{"status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		HTTPInFlight,
+		UpstreamRequests,
+		UpstreamDuration,
+		UpstreamErrors,
+		CacheLookups,
+		PollerRefreshes,
+		RateLimited,
+		QuotaRejections,
+		UpstreamKeyBenches,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
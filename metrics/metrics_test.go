@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerExposesServiceAndRuntimeMetrics(t *testing.T) {
+	CacheLookups.WithLabelValues("hit").Inc()
+	UpstreamRequests.WithLabelValues("openweathermap", "weather", "200").Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	body, _ := io.ReadAll(w.Body)
+	for _, want := range []string{
+		`weathering_cache_lookups_total{result="hit"}`,
+		`weathering_upstream_requests_total{endpoint="weather",provider="openweathermap",status="200"}`,
+		"go_goroutines",
+		"process_start_time_seconds",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("expected %s in metrics output", want)
+		}
+	}
+}
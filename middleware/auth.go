@@ -0,0 +1,371 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"weathering-with-go/config"
+	"weathering-with-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys set by the authentication middleware
+const (
+	APIKeyContextKey      = "api_key"
+	PrincipalContextKey   = "principal"
+	ClientIDContextKey    = "client_id"
+	UpstreamKeyContextKey = "upstream_api_key"
+	authRequiredKey       = "auth_required"
+	anonymousScopesKey    = "anonymous_scopes"
+
+	// APIKeyHeader is the dedicated header for client API keys
+	APIKeyHeader = "X-API-Key"
+	// UpstreamKeyHeader is the dedicated header for callers bringing their own OpenWeatherMap key
+	UpstreamKeyHeader = "X-OpenWeatherMap-Key"
+
+	// AuthMethodAPIKey marks principals authenticated with a client API key
+	AuthMethodAPIKey = "api_key"
+)
+
+// Scopes that routes may require
+const (
+	ScopeWeatherRead = "weather:read"
+	ScopeAdmin       = "admin"
+	ScopeMetrics     = "metrics"
+)
+
+// DefaultKeyScopes are granted to API keys configured without explicit scopes
+var DefaultKeyScopes = []string{ScopeWeatherRead}
+
+// DefaultAnonymousScopes are what anonymous callers may do while no client authentication is
+// configured: the weather API is open, while admin and metrics routes stay closed
+var DefaultAnonymousScopes = []string{ScopeWeatherRead}
+
+// Principal is an authenticated caller, identified by an API key or a JWT
+type Principal struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Scopes  []string `json:"scopes"`
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey holds the metadata of a client API key. Only the SHA-256 hash of the key is kept.
+type APIKey struct {
+	Owner   string   `json:"owner"`
+	Hash    string   `json:"hash"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Enabled bool     `json:"enabled"`
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore holds client API keys indexed by hash
+type KeyStore struct {
+	keys map[string]*APIKey
+}
+
+// keyFileEntry is one entry of the API key file; Enabled defaults to true when omitted
+type keyFileEntry struct {
+	Owner   string   `json:"owner"`
+	Hash    string   `json:"hash"`
+	Scopes  []string `json:"scopes"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash under which a key is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewKeyStore builds a key store from the keys in config and the optional key file.
+// Plain-text keys from config are hashed immediately and never kept in memory.
+func NewKeyStore(cfg *config.Config) (*KeyStore, error) {
+	store := &KeyStore{keys: make(map[string]*APIKey)}
+
+	for _, key := range cfg.APIKeys {
+		store.Add(&APIKey{
+			Owner:   key.Owner,
+			Hash:    HashAPIKey(key.Key),
+			Scopes:  key.Scopes,
+			Enabled: true,
+		})
+	}
+
+	if cfg.APIKeysFile != "" {
+		if err := store.loadFile(cfg.APIKeysFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+// Add registers a key; a later key with the same hash replaces the earlier one
+func (s *KeyStore) Add(key *APIKey) {
+	s.keys[strings.ToLower(key.Hash)] = key
+}
+
+// Len returns the number of configured keys
+func (s *KeyStore) Len() int {
+	return len(s.keys)
+}
+
+// Lookup returns the metadata for a plain-text key
+func (s *KeyStore) Lookup(key string) (*APIKey, bool) {
+	apiKey, ok := s.keys[HashAPIKey(key)]
+	return apiKey, ok
+}
+
+// loadFile reads a JSON array of hashed keys
+func (s *KeyStore) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+
+	var entries []keyFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse API key file: %w", err)
+	}
+
+	for i, entry := range entries {
+		hash := strings.TrimPrefix(strings.ToLower(entry.Hash), "sha256:")
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("API key file entry %d (%s): hash must be a hex-encoded SHA-256 digest", i, entry.Owner)
+		}
+
+		enabled := entry.Enabled == nil || *entry.Enabled
+		s.Add(&APIKey{
+			Owner:   entry.Owner,
+			Hash:    hash,
+			Scopes:  entry.Scopes,
+			Enabled: enabled,
+		})
+	}
+
+	return nil
+}
+
+// APIKeyAuth identifies clients by API key, accepted in the X-API-Key header or as
+// "Authorization: Bearer <key>" / "Authorization: ApiKey <key>". Requests presenting an
+// unknown or disabled key are rejected; requests without a key continue anonymously and
+// are turned away by RequireScopes on protected routes when authentication is configured.
+// Requests already authenticated by JWTAuth are passed through.
+func APIKeyAuth(store *KeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store.Len() > 0 {
+			c.Set(authRequiredKey, true)
+		}
+
+		if _, ok := PrincipalFromContext(c); ok {
+			c.Next()
+			return
+		}
+
+		key := extractAPIKey(c.Request)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		apiKey, ok := store.Lookup(key)
+		if !ok {
+			abortUnauthorized(c, "Invalid API key")
+			return
+		}
+
+		if !apiKey.Enabled {
+			utils.SendError(c, utils.NewAPIError(http.StatusForbidden, "API key is disabled"))
+			c.Abort()
+			return
+		}
+
+		scopes := apiKey.Scopes
+		if len(scopes) == 0 {
+			scopes = DefaultKeyScopes
+		}
+
+		c.Set(APIKeyContextKey, apiKey)
+		setPrincipal(c, &Principal{Subject: apiKey.Owner, Method: AuthMethodAPIKey, Scopes: scopes})
+		c.Next()
+	}
+}
+
+// AnonymousScopes sets the scopes anonymous callers have while no client authentication is
+// configured, replacing DefaultAnonymousScopes. Once API keys or JWTs are configured, or client
+// certificates are required, anonymous callers have no scopes.
+func AnonymousScopes(scopes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(anonymousScopesKey, scopes)
+		c.Next()
+	}
+}
+
+// RequireAuth rejects anonymous requests when client authentication is configured
+func RequireAuth() gin.HandlerFunc {
+	return RequireScopes()
+}
+
+// RequireScopes rejects anonymous requests and principals lacking any of the given scopes.
+// When no client authentication is configured, requests pass if anonymous callers have every
+// scope (see AnonymousScopes); otherwise the route answers 404, so admin and metrics routes
+// fail closed instead of being open to anyone.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool(authRequiredKey) {
+			for _, scope := range scopes {
+				if !HasScope(c, scope) {
+					utils.SendError(c, utils.NewAPIError(http.StatusNotFound, "Not found"))
+					c.Abort()
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		principal, ok := PrincipalFromContext(c)
+		if !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				utils.SendError(c, utils.NewAPIError(http.StatusForbidden, "Insufficient scope", "Requires scope "+scope))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// HasScope reports whether the caller may use scope: the authenticated principal's scopes, or
+// the anonymous scopes while no client authentication is configured
+func HasScope(c *gin.Context, scope string) bool {
+	if principal, ok := PrincipalFromContext(c); ok {
+		return principal.HasScope(scope)
+	}
+	if c.GetBool(authRequiredKey) {
+		return false
+	}
+
+	anonymous := DefaultAnonymousScopes
+	if value, ok := c.Get(anonymousScopesKey); ok {
+		anonymous, _ = value.([]string)
+	}
+	for _, s := range anonymous {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// UpstreamKey accepts a caller's own OpenWeatherMap key from UpstreamKeyHeader and stores it in
+// the gin context. The header is removed from the request so nothing downstream can log it.
+// When bring-your-own-key mode is disabled, requests carrying the header are rejected.
+func UpstreamKey(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(UpstreamKeyHeader))
+		c.Request.Header.Del(UpstreamKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if !enabled {
+			utils.SendError(c, utils.NewAPIError(http.StatusBadRequest, "Caller-supplied OpenWeatherMap keys are disabled"))
+			c.Abort()
+			return
+		}
+
+		c.Set(UpstreamKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// APIKeyFromContext returns the authenticated key's metadata, if any
+func APIKeyFromContext(c *gin.Context) (*APIKey, bool) {
+	value, ok := c.Get(APIKeyContextKey)
+	if !ok {
+		return nil, false
+	}
+	apiKey, ok := value.(*APIKey)
+	return apiKey, ok
+}
+
+// PrincipalFromContext returns the authenticated caller, if any
+func PrincipalFromContext(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(PrincipalContextKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*Principal)
+	return principal, ok
+}
+
+// ClientID identifies the caller for accounting: the authenticated subject, otherwise the client IP
+func ClientID(c *gin.Context) string {
+	if id := c.GetString(ClientIDContextKey); id != "" {
+		return id
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// extractAPIKey reads a client API key from the request headers
+func extractAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key
+	}
+
+	scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && (strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "ApiKey")) {
+		return strings.TrimSpace(value)
+	}
+
+	return ""
+}
+
+// setPrincipal records the authenticated caller and the client ID used for rate limits and quotas
+func setPrincipal(c *gin.Context, principal *Principal) {
+	c.Set(PrincipalContextKey, principal)
+	prefix := principal.Method
+	if prefix == AuthMethodAPIKey {
+		prefix = "key" // the client ID format used since before JWT support, kept so usage counters carry over
+	}
+	c.Set(ClientIDContextKey, prefix+":"+principal.Subject)
+}
+
+// abortUnauthorized sends a 401 with a WWW-Authenticate challenge and stops the chain
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="weathering-with-go"`)
+	utils.SendError(c, utils.NewAPIError(http.StatusUnauthorized, message))
+	c.Abort()
+}
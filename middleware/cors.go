@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"weathering-with-go/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// corsAllowedHeaders are the request headers browsers may send cross-origin
+	corsAllowedHeaders = "Origin, Content-Type, Accept, Authorization, X-Request-ID, X-API-Key, X-OpenWeatherMap-Key"
+	// corsExposedHeaders are the response headers scripts may read cross-origin
+	corsExposedHeaders = "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After"
+)
+
+// corsRoute is a registered route pattern and the methods it serves
+type corsRoute struct {
+	segments []string
+	methods  []string
+}
+
+// corsSettings are the configured origins and preflight options, replaced as a whole on reload
+type corsSettings struct {
+	allowAll    bool
+	origins     []string // lower-cased exact origins and path.Match patterns such as https://*.example.com
+	credentials bool
+	maxAge      time.Duration
+}
+
+// CORSPolicy decides which origins may call the API and answers preflight requests
+// with the methods actually registered for the requested path
+type CORSPolicy struct {
+	settings atomic.Pointer[corsSettings]
+	routes   []corsRoute
+}
+
+// NewCORSPolicy creates a policy from config. Call SetRoutes once all routes are registered.
+func NewCORSPolicy(cfg *config.Config) *CORSPolicy {
+	p := &CORSPolicy{}
+	p.Update(cfg)
+	return p
+}
+
+// Update replaces the allowed origins, credentials and preflight max age from config; it is
+// safe to call while requests are being served
+func (p *CORSPolicy) Update(cfg *config.Config) {
+	s := &corsSettings{
+		credentials: cfg.CORSAllowCredentials,
+		maxAge:      cfg.CORSMaxAge,
+	}
+	for _, origin := range cfg.CORSAllowedOrigins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		switch origin {
+		case "":
+		case "*":
+			s.allowAll = true
+		default:
+			s.origins = append(s.origins, origin)
+		}
+	}
+	p.settings.Store(s)
+}
+
+// SetRoutes records the methods served by each registered route, used to answer preflights.
+// Only registered methods are listed: gin does not answer HEAD with a GET route's handler.
+func (p *CORSPolicy) SetRoutes(routes gin.RoutesInfo) {
+	byPath := make(map[string][]string)
+	for _, route := range routes {
+		byPath[route.Path] = append(byPath[route.Path], route.Method)
+	}
+
+	p.routes = p.routes[:0]
+	for pattern, methods := range byPath {
+		methods = append(methods, http.MethodOptions)
+		sort.Strings(methods)
+		p.routes = append(p.routes, corsRoute{segments: strings.Split(pattern, "/"), methods: methods})
+	}
+}
+
+// AllowOrigin reports whether origin may make cross-origin requests
+func (p *CORSPolicy) AllowOrigin(origin string) bool {
+	return p.settings.Load().allowOrigin(origin)
+}
+
+func (s *corsSettings) allowOrigin(origin string) bool {
+	if s.allowAll {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, allowed := range s.origins {
+		if allowed == origin {
+			return true
+		}
+		if strings.Contains(allowed, "*") {
+			if ok, _ := path.Match(allowed, origin); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// methodsFor returns the methods registered for a request path, or nil when no route matches
+func (p *CORSPolicy) methodsFor(requestPath string) []string {
+	segments := strings.Split(requestPath, "/")
+	for _, route := range p.routes {
+		if matchRoute(route.segments, segments) {
+			return route.methods
+		}
+	}
+	return nil
+}
+
+// CORS applies the policy: allowed origins get CORS headers and preflight requests are
+// answered directly. Responses that depend on the Origin header are marked with Vary
+// so shared caches never serve one origin's headers to another.
+func CORS(policy *CORSPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		settings := policy.settings.Load()
+
+		// A single "*" response is the same for every origin; anything else is per-origin
+		if !settings.allowAll || settings.credentials {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !settings.allowOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if settings.allowAll && !settings.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if settings.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+			c.Next()
+			return
+		}
+
+		methods := policy.methodsFor(c.Request.URL.Path)
+		if methods == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+		if settings.maxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(settings.maxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// matchRoute matches request path segments against a gin route pattern with :param and *wildcard segments
+func matchRoute(pattern, segments []string) bool {
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
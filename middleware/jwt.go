@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"weathering-with-go/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuthMethodJWT marks principals authenticated with a JWT bearer token
+const AuthMethodJWT = "jwt"
+
+// JWTVerifier validates HS256 and RS256 bearer tokens against keys from config or a local JWKS file
+type JWTVerifier struct {
+	hmacKeys map[string][]byte         // by key ID; "" holds the key from config
+	rsaKeys  map[string]*rsa.PublicKey // by key ID; "" holds the key from config
+	parser   *jwt.Parser
+}
+
+// jwks is a JSON Web Key Set as defined by RFC 7517
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwk is a single JSON Web Key; only the fields needed for RSA and symmetric keys are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// NewJWTVerifier builds a verifier from config. It returns nil when JWT authentication is not configured.
+func NewJWTVerifier(cfg *config.Config) (*JWTVerifier, error) {
+	if !cfg.JWTEnabled() {
+		return nil, nil
+	}
+
+	v := &JWTVerifier{
+		hmacKeys: make(map[string][]byte),
+		rsaKeys:  make(map[string]*rsa.PublicKey),
+	}
+
+	if cfg.JWTSecret != "" {
+		v.hmacKeys[""] = []byte(cfg.JWTSecret)
+	}
+
+	if cfg.JWTPublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.JWTPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT public key: %w", err)
+		}
+		v.rsaKeys[""] = key
+	}
+
+	if cfg.JWTJWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWTJWKSFile); err != nil {
+			return nil, err
+		}
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.JWTLeeway),
+	}
+	if cfg.JWTIssuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		options = append(options, jwt.WithAudience(cfg.JWTAudience))
+	}
+	v.parser = jwt.NewParser(options...)
+
+	return v, nil
+}
+
+// Verify checks a token's signature and registered claims and returns the principal it identifies
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return &Principal{
+		Subject: subject,
+		Method:  AuthMethodJWT,
+		Scopes:  claimScopes(claims),
+	}, nil
+}
+
+// key selects the verification key for a token by algorithm and key ID
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if key, ok := lookupKey(v.hmacKeys, kid); ok {
+			return key, nil
+		}
+	case jwt.SigningMethodRS256.Alg():
+		if key, ok := lookupKey(v.rsaKeys, kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no %s key matches key ID %q", token.Method.Alg(), kid)
+}
+
+// loadJWKS reads RSA and symmetric signing keys from a JWKS file
+func (v *JWTVerifier) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	for i, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Kty {
+		case "RSA":
+			if key.Alg != "" && key.Alg != jwt.SigningMethodRS256.Alg() {
+				continue
+			}
+			pub, err := parseRSAJWK(key)
+			if err != nil {
+				return fmt.Errorf("JWKS key %d (%s): %w", i, key.Kid, err)
+			}
+			v.rsaKeys[key.Kid] = pub
+		case "oct":
+			if key.Alg != "" && key.Alg != jwt.SigningMethodHS256.Alg() {
+				continue
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) < 32 {
+				return fmt.Errorf("JWKS key %d (%s): symmetric keys must be base64url-encoded and at least 32 bytes", i, key.Kid)
+			}
+			v.hmacKeys[key.Kid] = secret
+		}
+	}
+
+	return nil
+}
+
+// JWTAuth authenticates requests carrying "Authorization: Bearer <jwt>". Invalid or expired tokens
+// are rejected; other requests are left to APIKeyAuth. A nil verifier disables the middleware.
+func JWTAuth(verifier *JWTVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if verifier == nil {
+			c.Next()
+			return
+		}
+		c.Set(authRequiredKey, true)
+
+		token := bearerToken(c.Request)
+		if !looksLikeJWT(token) {
+			c.Next()
+			return
+		}
+
+		principal, err := verifier.Verify(token)
+		if err != nil {
+			abortUnauthorized(c, "Invalid bearer token")
+			return
+		}
+
+		setPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// claimScopes reads scopes from the space-separated "scope" claim (RFC 8693) and the
+// "scp" claim, which issuers send either as a string or as an array
+func claimScopes(claims jwt.MapClaims) []string {
+	var scopes []string
+	for _, name := range []string{"scope", "scp"} {
+		switch value := claims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(value)...)
+		case []interface{}:
+			for _, item := range value {
+				if scope, ok := item.(string); ok && scope != "" {
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+	}
+	return scopes
+}
+
+// parseRSAJWK decodes the modulus and exponent of an RSA JWK
+func parseRSAJWK(key jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid RSA modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// lookupKey returns the key for kid, falling back to the only key when the token names none
+func lookupKey[K any](keys map[string]K, kid string) (K, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	var zero K
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return zero, false
+}
+
+// bearerToken returns the credential of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// looksLikeJWT reports whether a credential has the three dot-separated segments of a JWS
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
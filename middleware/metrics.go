@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"weathering-with-go/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Label values standing in for client-chosen input. Paths and methods come from the request,
+// so only route patterns and standard methods are used as labels; anything else is folded
+// into one value, which keeps the number of metric series bounded.
+const (
+	unmatchedRoute = "unmatched"
+	otherMethod    = "other"
+)
+
+// knownMethods are the HTTP methods recorded under their own name
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Metrics records request counts, latency and in-flight requests per route pattern and status
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		if !knownMethods[method] {
+			method = otherMethod
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequests.WithLabelValues(method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -1,25 +1,109 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"weathering-with-go/config"
+	"weathering-with-go/metrics"
+	"weathering-with-go/redact"
+	"weathering-with-go/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestCORSHeaders(t *testing.T) {
 	gin.SetMode(gin.TestMode)
+	policy := NewCORSPolicy(&config.Config{
+		CORSAllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		CORSAllowCredentials: true,
+		CORSMaxAge:           10 * time.Minute,
+	})
 	router := gin.New()
-	router.Use(CORS())
-	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.Use(CORS(policy))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	router.GET("/api/v1/weather/current", ok)
+	router.POST("/api/v1/weather/current", ok)
+	router.GET("/admin/watched/:location", ok)
+	policy.SetRoutes(router.Routes())
 
-	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	send := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "/api/v1/weather/current", "https://app.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("expected origin to be echoed, got %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected credentials to be allowed")
+	}
+	if !slices.Contains(w.Header().Values("Vary"), "Origin") {
+		t.Fatalf("expected Vary: Origin, got %v", w.Header().Values("Vary"))
+	}
+
+	w = send(http.MethodGet, "/api/v1/weather/current", "https://evil.example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("disallowed origin must get no CORS headers, got %d %v", w.Code, w.Header())
+	}
 
-	if w.Result().Header.Get("Access-Control-Allow-Origin") != "*" {
-		t.Fatalf("CORS header missing")
+	w = send(http.MethodOptions, "/api/v1/weather/current", "https://eu.example.org")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 preflight for wildcard origin, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, OPTIONS, POST" {
+		t.Fatalf("unexpected allowed methods %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Fatalf("unexpected max age %q", got)
+	}
+
+	w = send(http.MethodOptions, "/admin/watched/London", "https://app.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, OPTIONS" {
+		t.Fatalf("unexpected allowed methods for parameterised route %q", got)
+	}
+
+	if w = send(http.MethodOptions, "/api/v1/weather/current", "https://evil.example.com"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 preflight for disallowed origin, got %d", w.Code)
+	}
+	if w = send(http.MethodOptions, "/nowhere", "https://app.example.com"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 preflight for unknown path, got %d", w.Code)
+	}
+
+	// A reloaded policy applies to the next request
+	policy.Update(&config.Config{CORSAllowedOrigins: []string{"https://evil.example.com"}})
+	w = send(http.MethodGet, "/api/v1/weather/current", "https://evil.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://evil.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("expected the updated origins without credentials, got %v", w.Header())
+	}
+	if w = send(http.MethodGet, "/api/v1/weather/current", "https://app.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected the removed origin to be rejected")
 	}
 }
 
@@ -27,13 +111,524 @@ func TestRequestIDAddsHeader(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	router.Use(RequestID())
+	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, c.GetString(utils.RequestIDKey)) })
+
+	send := func(header, value string) string {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("X-Request-ID") != w.Body.String() {
+			t.Fatalf("header %q and context %q disagree", w.Header().Get("X-Request-ID"), w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := send("", "")
+		if len(id) != 36 || id[14] != '7' || !strings.ContainsRune("89ab", rune(id[19])) {
+			t.Fatalf("expected a UUIDv7, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate request ID %q", id)
+		}
+		seen[id] = true
+	}
+
+	if id := send("X-Request-ID", "upstream-proxy.abc:123"); id != "upstream-proxy.abc:123" {
+		t.Fatalf("expected incoming request ID to be kept, got %q", id)
+	}
+	if id := send("X-Request-ID", "bad id\r\nX-Injected: 1"); strings.Contains(id, "bad") {
+		t.Fatalf("expected invalid request ID to be replaced, got %q", id)
+	}
+	if id := send("X-Request-ID", strings.Repeat("a", 129)); len(id) != 36 {
+		t.Fatalf("expected overlong request ID to be replaced, got %q", id)
+	}
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if id := send("traceparent", traceparent); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected trace ID from traceparent, got %q", id)
+	}
+	if id := send("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"); len(id) != 36 {
+		t.Fatalf("expected all-zero trace ID to be rejected, got %q", id)
+	}
+}
+
+func newAuthRouter(store *KeyStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(APIKeyAuth(store))
+	router.GET("/public", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/private", RequireAuth(), func(c *gin.Context) {
+		key, _ := APIKeyFromContext(c)
+		c.String(http.StatusOK, key.Owner+" "+ClientID(c))
+	})
+	return router
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	store, err := NewKeyStore(&config.Config{APIKeys: []config.ClientAPIKey{{Owner: "dashboard", Key: "s3cret", Scopes: []string{"weather:read"}}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.Add(&APIKey{Owner: "retired", Hash: HashAPIKey("old"), Enabled: false})
+	router := newAuthRouter(store)
+
+	cases := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		code   int
+	}{
+		{"public without key", "/public", "", "", http.StatusOK},
+		{"private without key", "/private", "", "", http.StatusUnauthorized},
+		{"x-api-key header", "/private", "X-API-Key", "s3cret", http.StatusOK},
+		{"bearer header", "/private", "Authorization", "Bearer s3cret", http.StatusOK},
+		{"unknown key", "/public", "X-API-Key", "nope", http.StatusUnauthorized},
+		{"disabled key", "/private", "X-API-Key", "old", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected %d got %d", tc.name, tc.code, w.Code)
+		}
+		if tc.code == http.StatusOK && tc.path == "/private" && w.Body.String() != "dashboard key:dashboard" {
+			t.Fatalf("%s: unexpected body %q", tc.name, w.Body.String())
+		}
+	}
+}
+
+func TestAdminRoutesFailClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(store *KeyStore, anonymous ...gin.HandlerFunc) *gin.Engine {
+		router := gin.New()
+		router.Use(APIKeyAuth(store))
+		router.Use(anonymous...)
+		router.GET("/weather", RequireScopes(ScopeWeatherRead), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+		router.GET("/admin", RequireScopes(ScopeAdmin), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+		return router
+	}
+	get := func(router *gin.Engine, path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	// Without any authentication the weather API is open but admin routes are not
+	open := newRouter(&KeyStore{keys: map[string]*APIKey{}})
+	if code := get(open, "/weather"); code != http.StatusOK {
+		t.Fatalf("expected the open weather API, got %d", code)
+	}
+	if code := get(open, "/admin"); code != http.StatusNotFound {
+		t.Fatalf("expected admin routes to fail closed, got %d", code)
+	}
+
+	// Operators may opt in to anonymous admin access explicitly
+	optedIn := newRouter(&KeyStore{keys: map[string]*APIKey{}}, AnonymousScopes([]string{ScopeWeatherRead, ScopeAdmin}))
+	if code := get(optedIn, "/admin"); code != http.StatusOK {
+		t.Fatalf("expected opted-in anonymous admin access, got %d", code)
+	}
+
+	// Once authentication is configured the opt-in no longer applies
+	store, err := NewKeyStore(&config.Config{APIKeys: []config.ClientAPIKey{{Owner: "ops", Key: "ops-key", Scopes: []string{ScopeAdmin}}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code := get(newRouter(store, AnonymousScopes([]string{ScopeAdmin})), "/admin"); code != http.StatusUnauthorized {
+		t.Fatalf("expected anonymous admin requests to need a key once keys are configured, got %d", code)
+	}
+
+	// Optional client certificates leave callers without one anonymous; required ones do not
+	empty := &KeyStore{keys: map[string]*APIKey{}}
+	optionalCerts := newRouter(empty, ClientCertAuth(&config.Config{TLSClientCAFile: "ca.crt", TLSClientAuth: "optional"}))
+	if code := get(optionalCerts, "/weather"); code != http.StatusOK {
+		t.Fatalf("expected optional certificates to keep the anonymous scopes, got %d", code)
+	}
+	requiredCerts := newRouter(empty, ClientCertAuth(&config.Config{TLSClientCAFile: "ca.crt", TLSClientAuth: "require"}))
+	if code := get(requiredCerts, "/weather"); code != http.StatusUnauthorized {
+		t.Fatalf("expected required certificates to reject anonymous callers, got %d", code)
+	}
+}
+
+func TestKeyStoreLoadsHashedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"owner":"ops","hash":"sha256:` + HashAPIKey("ops-key") + `","scopes":["admin"]}]`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	store, err := NewKeyStore(&config.Config{APIKeysFile: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, ok := store.Lookup("ops-key")
+	if !ok || !key.Enabled || !key.HasScope("admin") {
+		t.Fatalf("expected enabled admin key got %+v", key)
+	}
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(60, 2)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	router := gin.New()
+	router.Use(RateLimit(limiter))
 	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	router.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	send := func(path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send("/ping", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 got %d", i, w.Code)
+		}
+	}
+
+	w := send("/ping", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Limit") != "2" {
+		t.Fatalf("unexpected rate limit headers: %v", w.Header())
+	}
+
+	if w := send("/ping", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("expected other clients to have their own bucket got %d", w.Code)
+	}
+	if w := send("/health", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("expected health checks to bypass the limiter got %d", w.Code)
+	}
+
+	// One token is refilled per second at 60/min
+	now = now.Add(time.Second)
+	if w := send("/ping", "10.0.0.1"); w.Code != http.StatusOK {
+		t.Fatalf("expected a refilled token got %d", w.Code)
+	}
+
+	// Idle buckets are evicted on the next sweep
+	now = now.Add(DefaultBucketIdleTTL + bucketSweepInterval + time.Second)
+	send("/ping", "10.0.0.3")
+	if _, ok := limiter.buckets["ip:10.0.0.1"]; ok {
+		t.Fatalf("expected idle bucket to be evicted")
+	}
+
+	// A disabled limiter lets everything through without headers
+	limiter.SetEnabled(false)
+	for i := 0; i < 5; i++ {
+		if w := send("/ping", "10.0.0.4"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("expected disabled limiter to pass request %d, got %d", i, w.Code)
+		}
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(60, 1)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	router := gin.New()
+	if err := router.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	router.Use(RateLimit(limiter))
+	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	send := func(peer, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = peer + ":1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A caller connecting directly cannot pick a new identity with a made-up header
+	if code := send("203.0.113.7", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("expected first request to pass got %d", code)
+	}
+	if code := send("203.0.113.7", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected spoofed X-Forwarded-For to share the peer's bucket, got %d", code)
+	}
+
+	// Behind a trusted proxy the forwarded address identifies the client
+	if code := send("10.0.0.5", "198.51.100.3"); code != http.StatusOK {
+		t.Fatalf("expected proxied client to pass got %d", code)
+	}
+	if code := send("10.0.0.5", "198.51.100.4"); code != http.StatusOK {
+		t.Fatalf("expected another proxied client to have its own bucket, got %d", code)
+	}
+	if code := send("10.0.0.5", "198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected proxied client to be limited got %d", code)
+	}
+}
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	router := gin.New()
+	router.Use(RequestID(), Logger(logger, &config.Config{RedactParams: []string{"session"}}))
+	router.GET("/weather/:location", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/London?units=metric&appid=owm-secret&session=session-secret", nil)
+	req.Header.Set("Authorization", "Bearer header-secret")
+	req.Header.Set("X-Request-ID", "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	for _, secret := range []string{"owm-secret", "session-secret", "header-secret"} {
+		if strings.Contains(line, secret) {
+			t.Fatalf("secret %q leaked into access log: %q", secret, line)
+		}
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log is not JSON: %v (%q)", err, line)
+	}
+	for field, want := range map[string]interface{}{
+		"msg":        "request",
+		"method":     "GET",
+		"route":      "/weather/:location",
+		"status":     float64(200),
+		"request_id": "req-1",
+		"client":     "ip:192.0.2.1",
+	} {
+		if entry[field] != want {
+			t.Fatalf("%s: expected %v got %v", field, want, entry[field])
+		}
+	}
+	if path := entry["path"].(string); !strings.Contains(path, "units=metric") || !strings.Contains(path, "appid="+redact.Mask) || !strings.Contains(path, "session="+redact.Mask) {
+		t.Fatalf("expected the query with only its secrets masked in access log, got %v", entry["path"])
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	jwksJSON := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"rsa-1","use":"sig","alg":"RS256","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()))
+	if err := os.WriteFile(jwksPath, []byte(jwksJSON), 0o600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+
+	verifier, err := NewJWTVerifier(&config.Config{
+		JWTSecret:   string(secret),
+		JWTJWKSFile: jwksPath,
+		JWTIssuer:   "https://auth.example.com",
+		JWTAudience: "weathering-with-go",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store, _ := NewKeyStore(&config.Config{})
+	router := gin.New()
+	router.Use(JWTAuth(verifier), APIKeyAuth(store))
+	router.GET("/weather", RequireScopes(ScopeWeatherRead), func(c *gin.Context) { c.String(http.StatusOK, ClientID(c)) })
+	router.GET("/admin", RequireScopes(ScopeAdmin), func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	claims := func(mutate func(jwt.MapClaims)) jwt.MapClaims {
+		now := time.Now()
+		c := jwt.MapClaims{
+			"sub":   "reporting-app",
+			"iss":   "https://auth.example.com",
+			"aud":   "weathering-with-go",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "weather:read",
+		}
+		if mutate != nil {
+			mutate(c)
+		}
+		return c
+	}
+	hs256 := func(c jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(secret)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return token
+	}
+	rs256 := func(c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+		token.Header["kid"] = "rsa-1"
+		signed, err := token.SignedString(rsaKey)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	cases := []struct {
+		name  string
+		path  string
+		token string
+		code  int
+	}{
+		{"no token", "/weather", "", http.StatusUnauthorized},
+		{"hs256", "/weather", hs256(claims(nil)), http.StatusOK},
+		{"rs256 from jwks", "/weather", rs256(claims(nil)), http.StatusOK},
+		{"scp array", "/admin", rs256(claims(func(c jwt.MapClaims) { delete(c, "scope"); c["scp"] = []string{"admin"} })), http.StatusOK},
+		{"missing scope", "/admin", hs256(claims(nil)), http.StatusForbidden},
+		{"expired", "/weather", hs256(claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() })), http.StatusUnauthorized},
+		{"no expiry", "/weather", hs256(claims(func(c jwt.MapClaims) { delete(c, "exp") })), http.StatusUnauthorized},
+		{"not yet valid", "/weather", hs256(claims(func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() })), http.StatusUnauthorized},
+		{"wrong audience", "/weather", hs256(claims(func(c jwt.MapClaims) { c["aud"] = "someone-else" })), http.StatusUnauthorized},
+		{"wrong issuer", "/weather", hs256(claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" })), http.StatusUnauthorized},
+		{"bad signature", "/weather", hs256(claims(nil)) + "x", http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Fatalf("%s: expected %d got %d (%s)", tc.name, tc.code, w.Code, w.Body.String())
+		}
+		if tc.code == http.StatusOK && tc.path == "/weather" && w.Body.String() != "jwt:reporting-app" {
+			t.Fatalf("%s: unexpected client ID %q", tc.name, w.Body.String())
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		ContentSecurityPolicy:     "default-src 'none'",
+		PermissionsPolicy:         "geolocation=()",
+		CrossOriginResourcePolicy: "same-origin",
+		HSTSMaxAge:                time.Hour,
+	}
+	router := gin.New()
+	router.Use(Security(cfg))
+	router.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	for header, want := range map[string]string{
+		"Content-Security-Policy":      "default-src 'none'",
+		"Permissions-Policy":           "geolocation=()",
+		"Cross-Origin-Opener-Policy":   "same-origin",
+		"Cross-Origin-Resource-Policy": "same-origin",
+		"X-Content-Type-Options":       "nosniff",
+		"X-XSS-Protection":             "0",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Fatalf("%s: expected %q got %q", header, want, got)
+		}
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatalf("HSTS must not be sent over plain HTTP")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/ping", nil))
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+		t.Fatalf("unexpected HSTS header %q", got)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(BodyLimit(64))
+	router.POST("/echo", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			utils.SendError(c, utils.BindError(err))
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	oversized := `{"location":"` + strings.Repeat("x", 100) + `"}`
 
-	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
 	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(oversized)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for declared length, got %d", w.Code)
+	}
+
+	// Without a Content-Length the body is cut off while it is read
+	req := httptest.NewRequest(http.MethodPost, "/echo", io.NopCloser(strings.NewReader(oversized)))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for streamed body, got %d", w.Code)
+	}
 
-	if w.Result().Header.Get("X-Request-ID") == "" {
-		t.Fatalf("expected X-Request-ID header to be set")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"location":"Oslo"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected small body to pass, got %d", w.Code)
+	}
+}
+
+func TestMetricsRecordsRoutePatterns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.GET("/admin/watched/:location", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	matched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/admin/watched/:location", "200")
+	unmatched := metrics.HTTPRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")
+	beforeMatched, beforeUnmatched := testutil.ToFloat64(matched), testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/admin/watched/London", "/admin/watched/Paris", "/random/path"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(matched) - beforeMatched; got != 2 {
+		t.Fatalf("expected 2 requests for the route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - beforeUnmatched; got != 1 {
+		t.Fatalf("expected 1 unmatched request, got %v", got)
+	}
+
+	// Made-up methods share one label value instead of creating a series each
+	series := testutil.CollectAndCount(metrics.HTTPRequests)
+	for _, method := range []string{"BREW", "PROPFIND", "X-RANDOM-1"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/random/path", nil))
+	}
+	if got := testutil.CollectAndCount(metrics.HTTPRequests) - series; got != 1 {
+		t.Fatalf("expected made-up methods to add one series, got %d", got)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(otherMethod, unmatchedRoute, "404")); got != 3 {
+		t.Fatalf("expected 3 requests labelled %q, got %v", otherMethod, got)
 	}
 }
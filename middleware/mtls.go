@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/x509"
+
+	"weathering-with-go/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthMethodClientCert marks principals authenticated with a verified TLS client certificate
+const AuthMethodClientCert = "mtls"
+
+// ClientCertAuth authenticates internal callers presenting a client certificate signed by the
+// configured client CA. The certificate's common name (or first DNS or URI SAN) becomes the
+// principal's subject, with the scopes from TLS_CLIENT_SCOPES. Callers that already presented
+// a JWT or API key keep that identity. Without a client CA the middleware does nothing.
+//
+// Certificates are optional by default: callers without one keep the anonymous scopes unless
+// API keys or JWTs are configured. With TLS_CLIENT_AUTH=require every caller needs a certificate.
+func ClientCertAuth(cfg *config.Config) gin.HandlerFunc {
+	scopes := cfg.TLSClientScopes
+	if len(scopes) == 0 {
+		scopes = DefaultKeyScopes
+	}
+
+	return func(c *gin.Context) {
+		if cfg.TLSClientCAFile == "" {
+			c.Next()
+			return
+		}
+		if cfg.TLSClientAuth == "require" {
+			c.Set(authRequiredKey, true)
+		}
+
+		if _, ok := PrincipalFromContext(c); ok {
+			c.Next()
+			return
+		}
+
+		// Only chains verified against the client CA count; the TLS handshake has already
+		// rejected invalid certificates
+		tlsState := c.Request.TLS
+		if tlsState == nil || len(tlsState.VerifiedChains) == 0 || len(tlsState.VerifiedChains[0]) == 0 {
+			c.Next()
+			return
+		}
+
+		if subject := certSubject(tlsState.VerifiedChains[0][0]); subject != "" {
+			setPrincipal(c, &Principal{Subject: subject, Method: AuthMethodClientCert, Scopes: scopes})
+		}
+		c.Next()
+	}
+}
+
+// certSubject names the holder of a client certificate
+func certSubject(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"weathering-with-go/metrics"
+	"weathering-with-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultBucketIdleTTL is how long an untouched bucket is kept before eviction
+	DefaultBucketIdleTTL = 10 * time.Minute
+	// bucketSweepInterval is the minimum time between idle bucket sweeps
+	bucketSweepInterval = time.Minute
+)
+
+// tokenBucket tracks the tokens available to one client
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter is a per-client token bucket limiter. Each client may burst up to burst
+// requests and then continues at ratePerMinute, refilled continuously.
+type RateLimiter struct {
+	disabled atomic.Bool
+
+	mu        sync.Mutex
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	idleTTL   time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// rateDecision is the outcome of taking a token
+type rateDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when denied
+}
+
+// NewRateLimiter creates a limiter allowing ratePerMinute sustained requests with the given burst
+func NewRateLimiter(ratePerMinute float64, burst int) *RateLimiter {
+	limiter := &RateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		idleTTL: DefaultBucketIdleTTL,
+		now:     time.Now,
+	}
+	limiter.SetLimits(ratePerMinute, burst)
+	return limiter
+}
+
+// SetLimits changes the sustained rate and burst for all clients
+func (l *RateLimiter) SetLimits(ratePerMinute float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = ratePerMinute / 60
+	l.burst = float64(burst)
+}
+
+// SetEnabled turns limiting on or off; a disabled limiter lets every request through
+func (l *RateLimiter) SetEnabled(enabled bool) {
+	l.disabled.Store(!enabled)
+}
+
+// take removes a token from the client's bucket if one is available
+func (l *RateLimiter) take(client string) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[client] = bucket
+	}
+
+	// Refill for the time since the last request
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*l.rate)
+	bucket.lastSeen = now
+
+	decision := rateDecision{limit: int(l.burst)}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.allowed = true
+	} else {
+		decision.retryAfter = l.timeFor(1 - bucket.tokens)
+	}
+
+	decision.remaining = int(math.Floor(bucket.tokens))
+	decision.reset = l.timeFor(l.burst - bucket.tokens)
+	return decision
+}
+
+// timeFor returns how long the refill takes to produce the given number of tokens
+func (l *RateLimiter) timeFor(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep evicts buckets idle for longer than idleTTL; callers must hold the lock
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > l.idleTTL {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// operationalPaths are health probes, metrics scrapes and build information, which are neither
+// rate limited nor traced
+var operationalPaths = map[string]bool{
+	"/health":        true,
+	"/api/v1/health": true,
+	"/livez":         true,
+	"/readyz":        true,
+	"/metrics":       true,
+	"/version":       true,
+}
+
+// RateLimit enforces the limiter per client (API key owner, otherwise client IP) and reports
+// the client's budget in RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// Requests over the limit get 429 with Retry-After. Health probes and metrics scrapes are never limited.
+func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if operationalPaths[c.FullPath()] || limiter.disabled.Load() {
+			c.Next()
+			return
+		}
+
+		decision := limiter.take(ClientID(c))
+
+		c.Header("RateLimit-Limit", strconv.Itoa(decision.limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.reset)))
+
+		if !decision.allowed {
+			metrics.RateLimited.Inc()
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(decision.retryAfter)))
+			utils.SendError(c, utils.NewAPIError(http.StatusTooManyRequests, "Rate limit exceeded", "Please try again later"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"weathering-with-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader carries the request ID on requests and responses
+	RequestIDHeader = "X-Request-ID"
+	// TraceparentHeader is the W3C Trace Context header
+	TraceparentHeader = "traceparent"
+	// maxRequestIDLength bounds accepted incoming request IDs
+	maxRequestIDLength = 128
+)
+
+// RequestID assigns every request an ID, reported in the X-Request-ID response header, access
+// logs, error responses and upstream calls. A valid incoming X-Request-ID is kept; otherwise the
+// trace ID of a valid W3C traceparent is used, so logs line up with the caller's traces.
+// Anything else gets a fresh UUIDv7. The ID is also recorded on the request's server span.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := incomingRequestID(c.Request)
+		if id == "" {
+			id = NewRequestID()
+		}
+
+		c.Header(RequestIDHeader, id)
+		c.Set(utils.RequestIDKey, id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", id))
+		c.Next()
+	}
+}
+
+// NewRequestID returns a UUIDv7 (RFC 9562): a millisecond timestamp followed by 74 random bits,
+// so IDs are unique across instances and sort by creation time
+func NewRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[6:])
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(b[:6], ms[2:])
+
+	b[6] = 0x70 | b[6]&0x0f // version 7
+	b[8] = 0x80 | b[8]&0x3f // RFC 9562 variant
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
+
+// incomingRequestID returns the caller's request ID if it is safe to reuse, or ""
+func incomingRequestID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(RequestIDHeader)); validRequestID(id) {
+		return id
+	}
+	if traceID, ok := parseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		return traceID
+	}
+	return ""
+}
+
+// validRequestID accepts short IDs made of letters, digits and - _ . : so they can be
+// logged and echoed without escaping
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceparent returns the trace ID of a W3C traceparent header
+// ("version-traceid-parentid-flags"), rejecting malformed and all-zero IDs
+func parseTraceparent(value string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", false
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return "", false
+	}
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return "", false
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// isLowerHex reports whether s consists only of lower-case hex digits
+func isLowerHex(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Tracing starts a server span per request, continuing the caller's trace when a W3C
+// traceparent header is present. Health probes and metrics scrapes are not traced.
+// The global tracer provider must be installed before the middleware is created.
+func Tracing(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !operationalPaths[r.URL.Path]
+	}))
+}
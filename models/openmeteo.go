@@ -0,0 +1,32 @@
+package models
+
+// OpenMeteoArchiveResponse represents the response from the Open-Meteo historical weather API
+type OpenMeteoArchiveResponse struct {
+	Latitude  float64          `json:"latitude"`
+	Longitude float64          `json:"longitude"`
+	Timezone  string           `json:"timezone"`
+	Hourly    *OpenMeteoHourly `json:"hourly,omitempty"`
+	Daily     *OpenMeteoDaily  `json:"daily,omitempty"`
+}
+
+// OpenMeteoHourly holds hourly series; every slice is indexed in parallel with Time
+type OpenMeteoHourly struct {
+	Time          []string   `json:"time"`
+	Temperature   []*float64 `json:"temperature_2m"`
+	Humidity      []*float64 `json:"relative_humidity_2m"`
+	Precipitation []*float64 `json:"precipitation"`
+	WindSpeed     []*float64 `json:"wind_speed_10m"`
+	WeatherCode   []*int     `json:"weather_code"`
+}
+
+// OpenMeteoDaily holds daily series; every slice is indexed in parallel with Time
+type OpenMeteoDaily struct {
+	Time          []string   `json:"time"`
+	MaxTemp       []*float64 `json:"temperature_2m_max"`
+	MinTemp       []*float64 `json:"temperature_2m_min"`
+	MeanTemp      []*float64 `json:"temperature_2m_mean"`
+	Humidity      []*float64 `json:"relative_humidity_2m_mean"`
+	Precipitation []*float64 `json:"precipitation_sum"`
+	WindSpeed     []*float64 `json:"wind_speed_10m_max"`
+	WeatherCode   []*int     `json:"weather_code"`
+}
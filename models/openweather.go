@@ -112,4 +112,13 @@ type City struct {
 	Timezone int         `json:"timezone"`
 	Sunrise  int64       `json:"sunrise"`
 	Sunset   int64       `json:"sunset"`
-}
\ No newline at end of file
+}
+
+// GeocodingResult represents a single match from the OpenWeatherMap geocoding API
+type GeocodingResult struct {
+	Name    string  `json:"name"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Country string  `json:"country"`
+	State   string  `json:"state,omitempty"`
+}
@@ -54,19 +54,173 @@ type Forecast struct {
 	UVIndex       float64   `json:"uv_index"`
 }
 
+// WeatherHistory represents observed weather for a past date range, shaped like a forecast response
+type WeatherHistory struct {
+	Location    Location       `json:"location"`
+	Forecast    []HistoryEntry `json:"forecast,omitempty"`
+	RequestTime time.Time      `json:"request_time"`
+}
+
+// HistoryEntry represents observed weather for one day or hour.
+// Readings the archive has no data for are omitted rather than reported as zero.
+type HistoryEntry struct {
+	Date          time.Time `json:"date"`
+	MaxTemp       *float64  `json:"max_temperature,omitempty"`
+	MinTemp       *float64  `json:"min_temperature,omitempty"`
+	AvgTemp       *float64  `json:"avg_temperature,omitempty"`
+	Condition     string    `json:"condition,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	Icon          string    `json:"icon,omitempty"`
+	Humidity      *int      `json:"humidity,omitempty"`
+	WindSpeed     *float64  `json:"wind_speed,omitempty"`
+	Precipitation *float64  `json:"precipitation,omitempty"`
+}
+
+// Observation represents a stored current-weather reading for a location
+type Observation struct {
+	Location   string    `json:"location"`
+	Units      string    `json:"units"`
+	ObservedAt time.Time `json:"observed_at"`
+	Current    Current   `json:"current"`
+}
+
+// ObservationSeries represents a time series of stored observations for a location
+type ObservationSeries struct {
+	Location     string        `json:"location"`
+	Units        string        `json:"units"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	Count        int           `json:"count"`
+	Observations []Observation `json:"observations"`
+}
+
 // WeatherRequest represents incoming API request parameters
 type WeatherRequest struct {
 	Location string `json:"location" form:"location" binding:"required"`
 	Days     int    `json:"days,omitempty" form:"days"`
 	Units    string `json:"units,omitempty" form:"units"` // metric, imperial, kelvin
-	Keys     string `json:"keys,omitempty" form:"keys"`
+}
+
+// BatchRequest represents a request for many locations at once
+type BatchRequest struct {
+	Type  string           `json:"type,omitempty"` // current (default) or forecast
+	Items []WeatherRequest `json:"items" binding:"required"`
+}
+
+// BatchResult represents the outcome of one batch item, in the same position as its request
+type BatchResult struct {
+	Index    int            `json:"index"`
+	Location string         `json:"location"`
+	Success  bool           `json:"success"`
+	Data     *WeatherData   `json:"data,omitempty"`
+	Error    *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchResponse represents the combined results of a batch request
+type BatchResponse struct {
+	Type      string        `json:"type"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// Comparison represents current conditions and daily forecasts for several locations side by side.
+// Differences are always relative to the baseline, which is the first requested location.
+type Comparison struct {
+	Units       string             `json:"units"`
+	Baseline    string             `json:"baseline"`
+	Locations   []ComparedLocation `json:"locations"`
+	Days        []ComparisonDay    `json:"days"`
+	RequestTime time.Time          `json:"request_time"`
+}
+
+// ComparedLocation represents one location's current conditions and their difference from the baseline
+type ComparedLocation struct {
+	Query      string            `json:"query"`
+	Location   Location          `json:"location"`
+	Current    Current           `json:"current"`
+	Difference CurrentDifference `json:"difference"`
+}
+
+// CurrentDifference represents current conditions minus the baseline's current conditions
+type CurrentDifference struct {
+	Temperature float64 `json:"temperature"`
+	FeelsLike   float64 `json:"feels_like"`
+	Humidity    int     `json:"humidity"`
+	Pressure    float64 `json:"pressure"`
+	WindSpeed   float64 `json:"wind_speed"`
+	CloudCover  int     `json:"cloud_cover"`
+}
+
+// ComparisonDay represents every location's forecast for the same date
+type ComparisonDay struct {
+	Date    time.Time            `json:"date"`
+	Entries []ComparisonDayEntry `json:"entries"`
+}
+
+// ComparisonDayEntry represents one location's forecast for a day and its difference from the baseline.
+// Difference is omitted when either side has no forecast for the date.
+type ComparisonDayEntry struct {
+	Query      string              `json:"query"`
+	Forecast   *Forecast           `json:"forecast,omitempty"`
+	Difference *ForecastDifference `json:"difference,omitempty"`
+}
+
+// ForecastDifference represents a daily forecast minus the baseline's forecast for the same date
+type ForecastDifference struct {
+	MaxTemp       float64 `json:"max_temperature"`
+	MinTemp       float64 `json:"min_temperature"`
+	AvgTemp       float64 `json:"avg_temperature"`
+	Humidity      int     `json:"humidity"`
+	WindSpeed     float64 `json:"wind_speed"`
+	Precipitation float64 `json:"precipitation"`
+}
+
+// UsageReport represents a client's upstream call consumption
+type UsageReport struct {
+	Client    string         `json:"client"`
+	Daily     UsageWindow    `json:"daily"`
+	Monthly   UsageWindow    `json:"monthly"`
+	Endpoints map[string]int `json:"endpoints"` // calls this month per upstream endpoint
+	Total     int64          `json:"total"`
+}
+
+// UsageWindow represents consumption within one quota window; a zero limit means unlimited
+type UsageWindow struct {
+	Period    string    `json:"period"`
+	Calls     int       `json:"calls"`
+	Limit     int       `json:"limit"`
+	Remaining *int      `json:"remaining,omitempty"` // nil when unlimited; 0 once the quota is used up
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// HealthReport represents the service's liveness or readiness.
+// Components is only reported by readiness checks.
+type HealthReport struct {
+	Status        string                     `json:"status"`
+	Service       string                     `json:"service"`
+	Version       string                     `json:"version"`
+	Commit        string                     `json:"commit,omitempty"`
+	Uptime        string                     `json:"uptime"`
+	UptimeSeconds int64                      `json:"uptime_seconds"`
+	Timestamp     time.Time                  `json:"timestamp"`
+	Components    map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+// ComponentHealth represents the state of one dependency in a readiness check
+type ComponentHealth struct {
+	Status    string     `json:"status"` // ok, degraded, fail or disabled
+	Message   string     `json:"message,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	LatencyMS float64    `json:"latency_ms,omitempty"`
 }
 
 // ErrorResponse represents API error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Error     string `json:"error"`
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // APIResponse represents a generic API response wrapper
@@ -0,0 +1,86 @@
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Mask replaces redacted values
+const Mask = "[REDACTED]"
+
+// DefaultParams are query parameters that always carry secrets
+var DefaultParams = []string{"key", "keys", "appid", "api_key", "apikey", "token", "access_token", "secret", "password"}
+
+// Redactor masks secrets in query strings and URLs before they are logged. Request headers
+// are never logged, so they need no redaction.
+type Redactor struct {
+	params map[string]bool
+}
+
+// New creates a redactor for the default sensitive names plus any extra query parameters
+func New(extraParams ...string) *Redactor {
+	r := &Redactor{
+		params: make(map[string]bool),
+	}
+	for _, p := range append(append([]string{}, DefaultParams...), extraParams...) {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			r.params[p] = true
+		}
+	}
+	return r
+}
+
+// Query masks the values of sensitive parameters in a raw query string, keeping everything else as-is
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		name, _, hasValue := strings.Cut(part, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if hasValue && r.params[strings.ToLower(name)] {
+			parts[i] = part[:strings.Index(part, "=")+1] + Mask
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Path masks sensitive parameters in a request path that may include a query string
+func (r *Redactor) Path(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	return base + "?" + r.Query(rawQuery)
+}
+
+// URL masks sensitive parameters and any user password in a URL string
+func (r *Redactor) URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return r.Path(rawURL)
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Mask)
+		}
+	}
+	u.RawQuery = r.Query(u.RawQuery)
+	return u.String()
+}
+
+// Secret masks a secret for display, keeping only the last four characters of long values
+// so operators can tell which key is configured
+func Secret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 12 {
+		return Mask
+	}
+	return Mask + secret[len(secret)-4:]
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"weathering-with-go/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	BatchTypeCurrent  = "current"
+	BatchTypeForecast = "forecast"
+	// DefaultBatchConcurrency bounds how many batch items are fetched from upstream at once
+	DefaultBatchConcurrency = 8
+	// DefaultBatchTimeout is the overall deadline for a batch request
+	DefaultBatchTimeout = 20 * time.Second
+)
+
+// BatchOutcome is the result of one batch item, in the same position as its request
+type BatchOutcome struct {
+	Data *models.WeatherData
+	Err  error
+}
+
+// GetBatch fetches current weather or forecasts for many locations using a bounded worker pool.
+// Outcomes are returned in input order. Items still pending when ctx is done fail with ctx.Err().
+func (w *WeatherService) GetBatch(ctx context.Context, batchType string, requests []models.WeatherRequest, concurrency int) []BatchOutcome {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	if concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	ctx, span := startSpan(ctx, "WeatherService.GetBatch", trace.SpanKindInternal,
+		attribute.String("weather.batch.type", batchType), attribute.Int("weather.batch.items", len(requests)))
+	defer span.End()
+
+	outcomes := make([]BatchOutcome, len(requests))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				outcomes[idx] = w.fetchBatchItem(ctx, batchType, requests[idx])
+			}
+		}()
+	}
+
+	for idx := range requests {
+		select {
+		case jobs <- idx:
+		case <-ctx.Done():
+			outcomes[idx] = BatchOutcome{Err: fmt.Errorf("batch item not started: %w", ctx.Err())}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return outcomes
+}
+
+// fetchBatchItem fetches a single batch item
+func (w *WeatherService) fetchBatchItem(ctx context.Context, batchType string, req models.WeatherRequest) BatchOutcome {
+	if err := ctx.Err(); err != nil {
+		return BatchOutcome{Err: fmt.Errorf("batch item not started: %w", err)}
+	}
+
+	var data *models.WeatherData
+	var err error
+	if batchType == BatchTypeForecast {
+		data, err = w.GetWeatherForecast(ctx, req.Location, req.Units, req.Days)
+	} else {
+		data, err = w.GetCurrentWeather(ctx, req.Location, req.Units)
+	}
+	return BatchOutcome{Data: data, Err: err}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"weathering-with-go/metrics"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache statuses reported for current-weather lookups
+const (
+	CacheHit    = "hit"    // served from the poller's in-memory results
+	CacheMiss   = "miss"   // fetched upstream although a poller is running
+	CacheBypass = "bypass" // fetched upstream with the caller's own key, never cached
+)
+
+// Upstream providers
+const (
+	ProviderOpenWeatherMap = "openweathermap"
+	ProviderOpenMeteo      = "open-meteo"
+)
+
+// CallInfo collects how a request was served (cache outcome and upstream providers) so the
+// access log can report it. It is safe for concurrent use by batch workers.
+type CallInfo struct {
+	mu        sync.Mutex
+	cache     map[string]int
+	providers map[string]bool
+}
+
+type callInfoKey struct{}
+
+// WithCallInfo returns a context that records how the request is served into the returned CallInfo
+func WithCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	info := &CallInfo{cache: make(map[string]int), providers: make(map[string]bool)}
+	return context.WithValue(ctx, callInfoKey{}, info), info
+}
+
+// Cache returns the request's cache status; "partial" when a batch mixed outcomes
+func (i *CallInfo) Cache() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	switch len(i.cache) {
+	case 0:
+		return ""
+	case 1:
+		for status := range i.cache {
+			return status
+		}
+	}
+	return "partial"
+}
+
+// Providers returns the upstream providers called, comma-separated and sorted
+func (i *CallInfo) Providers() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	names := make([]string, 0, len(i.providers))
+	for name := range i.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// noteCache records a cache outcome in metrics, on the current span and on the request's CallInfo, if any
+func noteCache(ctx context.Context, status string) {
+	metrics.CacheLookups.WithLabelValues(status).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attrCache.String(status))
+
+	if info, ok := ctx.Value(callInfoKey{}).(*CallInfo); ok {
+		info.mu.Lock()
+		info.cache[status]++
+		info.mu.Unlock()
+	}
+}
+
+// noteProvider records an upstream call on the request's CallInfo, if any
+func noteProvider(ctx context.Context, provider string) {
+	if info, ok := ctx.Value(callInfoKey{}).(*CallInfo); ok {
+		info.mu.Lock()
+		info.providers[provider] = true
+		info.mu.Unlock()
+	}
+}
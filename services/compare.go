@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"weathering-with-go/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CompareLocations fetches current weather and daily forecasts for every location, at most
+// DefaultBatchConcurrency upstream lookups at a time, and lines them up side by side. The first
+// location is the baseline for all differences.
+func (w *WeatherService) CompareLocations(ctx context.Context, locations []string, units string, days int) (comparison *models.Comparison, err error) {
+	if units == "" {
+		units = DefaultUnits
+	}
+
+	ctx, span := startSpan(ctx, "WeatherService.CompareLocations", trace.SpanKindInternal,
+		attribute.StringSlice("weather.locations", locations), attrUnits.String(units), attribute.Int("weather.days", days))
+	defer func() { endSpan(span, err) }()
+
+	current := make([]*models.WeatherData, len(locations))
+	forecast := make([]*models.WeatherData, len(locations))
+	// Lookup 2i is location i's current weather and 2i+1 its forecast
+	errs := make([]error, 2*len(locations))
+
+	concurrency := DefaultBatchConcurrency
+	if concurrency > len(errs) {
+		concurrency = len(errs)
+	}
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				i := job / 2
+				if job%2 == 0 {
+					current[i], errs[job] = w.GetCurrentWeather(ctx, locations[i], units)
+				} else {
+					forecast[i], errs[job] = w.GetWeatherForecast(ctx, locations[i], units, days)
+				}
+			}
+		}()
+	}
+	for job := range errs {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	// A comparison is only meaningful when every location is available
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buildComparison(locations, units, current, forecast), nil
+}
+
+// buildComparison computes differences against the baseline and aligns forecasts by date
+func buildComparison(locations []string, units string, current, forecast []*models.WeatherData) *models.Comparison {
+	comparison := &models.Comparison{
+		Units:       units,
+		Baseline:    locations[0],
+		Locations:   make([]models.ComparedLocation, len(locations)),
+		Days:        make([]models.ComparisonDay, 0),
+		RequestTime: time.Now(),
+	}
+
+	base := current[0].Current
+	for i, location := range locations {
+		cur := current[i].Current
+		comparison.Locations[i] = models.ComparedLocation{
+			Query:    location,
+			Location: current[i].Location,
+			Current:  cur,
+			Difference: models.CurrentDifference{
+				Temperature: cur.Temperature - base.Temperature,
+				FeelsLike:   cur.FeelsLike - base.FeelsLike,
+				Humidity:    cur.Humidity - base.Humidity,
+				Pressure:    cur.Pressure - base.Pressure,
+				WindSpeed:   cur.WindSpeed - base.WindSpeed,
+				CloudCover:  cur.CloudCover - base.CloudCover,
+			},
+		}
+	}
+
+	// Index each location's forecast by date so days line up even if coverage differs
+	byDate := make([]map[string]*models.Forecast, len(locations))
+	dateSet := make(map[string]time.Time)
+	for i := range locations {
+		byDate[i] = make(map[string]*models.Forecast)
+		for j := range forecast[i].Forecast {
+			day := &forecast[i].Forecast[j]
+			key := day.Date.Format("2006-01-02")
+			byDate[i][key] = day
+			dateSet[key] = day.Date
+		}
+	}
+
+	dates := make([]string, 0, len(dateSet))
+	for key := range dateSet {
+		dates = append(dates, key)
+	}
+	sort.Strings(dates)
+
+	for _, key := range dates {
+		day := models.ComparisonDay{Date: dateSet[key], Entries: make([]models.ComparisonDayEntry, len(locations))}
+		baseDay := byDate[0][key]
+		for i, location := range locations {
+			entry := models.ComparisonDayEntry{Query: location, Forecast: byDate[i][key]}
+			if entry.Forecast != nil && baseDay != nil {
+				entry.Difference = &models.ForecastDifference{
+					MaxTemp:       entry.Forecast.MaxTemp - baseDay.MaxTemp,
+					MinTemp:       entry.Forecast.MinTemp - baseDay.MinTemp,
+					AvgTemp:       entry.Forecast.AvgTemp - baseDay.AvgTemp,
+					Humidity:      entry.Forecast.Humidity - baseDay.Humidity,
+					WindSpeed:     entry.Forecast.WindSpeed - baseDay.WindSpeed,
+					Precipitation: entry.Forecast.Precipitation - baseDay.Precipitation,
+				}
+			}
+			day.Entries[i] = entry
+		}
+		comparison.Days = append(comparison.Days, day)
+	}
+
+	return comparison
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"weathering-with-go/models"
+)
+
+// Component states reported by readiness checks
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded" // impaired, but the service can still answer some requests
+	HealthFail     = "fail"
+	HealthDisabled = "disabled"
+)
+
+const (
+	// UpstreamProbeInterval is how long a provider probe result is reused before probing again,
+	// so frequent readiness checks cost at most one upstream call per interval
+	UpstreamProbeInterval = time.Minute
+	// UpstreamProbeTimeout bounds a single provider probe
+	UpstreamProbeTimeout = 5 * time.Second
+)
+
+// pinger is implemented by observation stores that can report their own availability
+type pinger interface {
+	Ping() error
+}
+
+// upstreamProbe caches the latest provider probe result
+type upstreamProbe struct {
+	mu     sync.Mutex
+	result models.ComponentHealth
+	at     time.Time
+}
+
+// StartDraining marks the service as shutting down. Readiness fails from then on, so load
+// balancers stop sending new requests while in-flight ones finish.
+func (w *WeatherService) StartDraining() {
+	w.draining.Store(true)
+}
+
+// Readiness checks everything the service needs to answer requests and reports each component's
+// state. ready is false when any component has failed; degraded and disabled components do not
+// count. An unreachable provider is only degraded: it affects every replica alike, so taking
+// them all out of rotation would turn upstream errors into a full outage and stop watched
+// locations from being served from memory.
+func (w *WeatherService) Readiness(ctx context.Context) (components map[string]models.ComponentHealth, ready bool) {
+	// Probe first: a rejected probe benches its key, which the config check then counts
+	provider := w.probeUpstream(ctx)
+	components = map[string]models.ComponentHealth{
+		"config":               w.configHealth(),
+		ProviderOpenWeatherMap: provider,
+		"observations":         w.observationsHealth(),
+		"poller":               w.pollerHealth(),
+	}
+	if w.draining.Load() {
+		components["server"] = models.ComponentHealth{Status: HealthFail, Message: "shutting down"}
+	}
+
+	ready = true
+	for _, component := range components {
+		if component.Status == HealthFail {
+			ready = false
+		}
+	}
+	return components, ready
+}
+
+// configHealth reports whether the service has what it needs to call upstream. It fails only
+// when no key is configured; a pool whose keys are all benched or out of quota is degraded, since
+// it recovers on its own and callers' own keys and cached locations are still served.
+func (w *WeatherService) configHealth() models.ComponentHealth {
+	if w.Keys == nil || w.Keys.Len() == 0 {
+		return models.ComponentHealth{Status: HealthFail, Message: "OpenWeatherMap API key is not configured"}
+	}
+	if available, total := w.Keys.Available(), w.Keys.Len(); available < total {
+		status := HealthOK
+		if available == 0 {
+			status = HealthDegraded
+		}
+		return models.ComponentHealth{Status: status, Message: fmt.Sprintf("%d of %d OpenWeatherMap API keys available", available, total)}
+	}
+	return models.ComponentHealth{Status: HealthOK}
+}
+
+// probeUpstream checks that OpenWeatherMap is reachable and accepts the server's API key with a
+// single-coordinate lookup, reporting HealthDegraded when it does not. The result is cached for
+// UpstreamProbeInterval; concurrent callers wait for the probe in flight rather than starting
+// their own.
+func (w *WeatherService) probeUpstream(ctx context.Context) models.ComponentHealth {
+	w.probe.mu.Lock()
+	defer w.probe.mu.Unlock()
+
+	if !w.probe.at.IsZero() && time.Since(w.probe.at) < UpstreamProbeInterval {
+		return w.probe.result
+	}
+
+	// Probes are system calls: counted in usage but never held to a client's quota, and
+	// never made with a caller's own key
+	ctx, cancel := context.WithTimeout(WithClientID(context.WithoutCancel(ctx), ProbeClientID), UpstreamProbeTimeout)
+	defer cancel()
+	ctx = WithUpstreamKey(ctx, "")
+
+	var response models.OpenWeatherMapResponse
+	start := time.Now()
+	apiKey, err := w.apiKey(ctx)
+	if err == nil {
+		params := url.Values{}
+		params.Add("lat", "0")
+		params.Add("lon", "0")
+		params.Add("appid", apiKey)
+		fullURL := fmt.Sprintf("%s%s?%s", OpenWeatherMapBaseURL, CurrentWeatherEndpoint, params.Encode())
+		err = w.getJSON(ctx, ProviderOpenWeatherMap, fullURL, "probe", &response)
+	}
+	checkedAt := time.Now().UTC()
+
+	result := models.ComponentHealth{
+		Status:    HealthOK,
+		CheckedAt: &checkedAt,
+		LatencyMS: durationMillis(time.Since(start)),
+	}
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized:
+		result.Status, result.Message = HealthDegraded, "OpenWeatherMap rejected the API key"
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Status, result.Message = HealthDegraded, "OpenWeatherMap did not respond in time"
+	default:
+		result.Status, result.Message = HealthDegraded, err.Error()
+	}
+
+	w.probe.result, w.probe.at = result, time.Now()
+	return result
+}
+
+// observationsHealth reports whether the observation store can be read
+func (w *WeatherService) observationsHealth() models.ComponentHealth {
+	if w.Observations == nil {
+		return models.ComponentHealth{Status: HealthDisabled}
+	}
+	if p, ok := w.Observations.(pinger); ok {
+		if err := p.Ping(); err != nil {
+			return models.ComponentHealth{Status: HealthFail, Message: err.Error()}
+		}
+	}
+	return models.ComponentHealth{Status: HealthOK}
+}
+
+// pollerHealth reports how many watched locations can be served from memory. Stale entries do not
+// fail readiness: requests for them fall back to upstream, which is checked separately.
+func (w *WeatherService) pollerHealth() models.ComponentHealth {
+	if w.Poller == nil {
+		return models.ComponentHealth{Status: HealthDisabled}
+	}
+
+	statuses := w.Poller.Statuses()
+	fresh := 0
+	for _, status := range statuses {
+		if status.Fresh {
+			fresh++
+		}
+	}
+	return models.ComponentHealth{
+		Status:  HealthOK,
+		Message: fmt.Sprintf("%d of %d watched locations fresh", fresh, len(statuses)),
+	}
+}
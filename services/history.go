@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"weathering-with-go/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	OpenWeatherMapGeoURL    = "https://api.openweathermap.org/geo/1.0"
+	GeocodingEndpoint       = "/direct"
+	OpenMeteoArchiveBaseURL = "https://archive-api.open-meteo.com/v1/archive"
+	HistoryIntervalHourly   = "hourly"
+	HistoryIntervalDaily    = "daily"
+
+	historyDateLayout = "2006-01-02"
+	hourlyTimeLayout  = "2006-01-02T15:04"
+)
+
+var (
+	hourlyVariables = []string{"temperature_2m", "relative_humidity_2m", "precipitation", "wind_speed_10m", "weather_code"}
+	dailyVariables  = []string{"temperature_2m_max", "temperature_2m_min", "temperature_2m_mean", "relative_humidity_2m_mean", "precipitation_sum", "wind_speed_10m_max", "weather_code"}
+)
+
+// GetWeatherHistory fetches observed weather for a location between start and end (inclusive dates).
+// The location is resolved with the OpenWeatherMap geocoding API and the observations come from the
+// Open-Meteo archive, returned as one models.HistoryEntry per hour or per day depending on interval.
+func (w *WeatherService) GetWeatherHistory(ctx context.Context, location, units string, start, end time.Time, interval string) (data *models.WeatherHistory, err error) {
+	if location == "" {
+		return nil, fmt.Errorf("location cannot be empty")
+	}
+
+	if units == "" {
+		units = DefaultUnits
+	}
+
+	if interval == "" {
+		interval = HistoryIntervalDaily
+	}
+
+	ctx, span := startSpan(ctx, "WeatherService.GetWeatherHistory", trace.SpanKindInternal,
+		attrLocation.String(location), attrUnits.String(units),
+		attribute.String("weather.interval", interval),
+		attribute.String("weather.start", start.Format(historyDateLayout)),
+		attribute.String("weather.end", end.Format(historyDateLayout)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	place, err := w.geocode(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build URL
+	params := url.Values{}
+	params.Add("latitude", fmt.Sprintf("%.4f", place.Lat))
+	params.Add("longitude", fmt.Sprintf("%.4f", place.Lon))
+	params.Add("start_date", start.Format(historyDateLayout))
+	params.Add("end_date", end.Format(historyDateLayout))
+	params.Add("timezone", "UTC")
+	if interval == HistoryIntervalHourly {
+		params.Add("hourly", strings.Join(hourlyVariables, ","))
+	} else {
+		params.Add("daily", strings.Join(dailyVariables, ","))
+	}
+	if units == "imperial" {
+		params.Add("temperature_unit", "fahrenheit")
+		params.Add("wind_speed_unit", "mph")
+	} else {
+		// Match OpenWeatherMap, which reports wind in m/s for metric and kelvin
+		params.Add("wind_speed_unit", "ms")
+	}
+
+	fullURL := fmt.Sprintf("%s?%s", OpenMeteoArchiveBaseURL, params.Encode())
+
+	var archive models.OpenMeteoArchiveResponse
+	if err := w.getJSON(ctx, ProviderOpenMeteo, fullURL, "history", &archive); err != nil {
+		return nil, err
+	}
+
+	// Convert to our internal model
+	history := w.convertHistoryResponse(archive, units)
+	history.Location = models.Location{
+		Name:      place.Name,
+		Country:   place.Country,
+		Region:    place.State,
+		Latitude:  place.Lat,
+		Longitude: place.Lon,
+		Timezone:  archive.Timezone,
+	}
+	return history, nil
+}
+
+// geocode resolves a free-form location to coordinates using the OpenWeatherMap geocoding API
+func (w *WeatherService) geocode(ctx context.Context, location string) (*models.GeocodingResult, error) {
+	apiKey, err := w.apiKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s%s", OpenWeatherMapGeoURL, GeocodingEndpoint)
+	params := url.Values{}
+	params.Add("q", location)
+	params.Add("limit", "1")
+	params.Add("appid", apiKey)
+
+	fullURL := fmt.Sprintf("%s?%s", endpoint, params.Encode())
+
+	var results []models.GeocodingResult
+	if err := w.getJSON(ctx, ProviderOpenWeatherMap, fullURL, "geocoding", &results); err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		// Reported like an upstream 404 so handlers map it to 404
+		return nil, &StatusError{Provider: ProviderOpenWeatherMap, StatusCode: http.StatusNotFound, Body: fmt.Sprintf("location %q not found", location)}
+	}
+
+	return &results[0], nil
+}
+
+// convertHistoryResponse converts an Open-Meteo archive response to our internal model
+func (w *WeatherService) convertHistoryResponse(archive models.OpenMeteoArchiveResponse, units string) *models.WeatherHistory {
+	var history []models.HistoryEntry
+
+	if archive.Hourly != nil {
+		h := archive.Hourly
+		for i, ts := range h.Time {
+			date, err := time.Parse(hourlyTimeLayout, ts)
+			if err != nil {
+				continue
+			}
+			temp := convertTemperature(valueAt(h.Temperature, i), units)
+			condition, description, icon := describeWeatherCode(intAt(h.WeatherCode, i))
+			history = append(history, models.HistoryEntry{
+				Date:          date,
+				MaxTemp:       temp,
+				MinTemp:       temp,
+				AvgTemp:       temp,
+				Condition:     condition,
+				Description:   description,
+				Icon:          icon,
+				Humidity:      percentAt(h.Humidity, i),
+				WindSpeed:     valueAt(h.WindSpeed, i),
+				Precipitation: valueAt(h.Precipitation, i),
+			})
+		}
+	}
+
+	if archive.Daily != nil {
+		d := archive.Daily
+		for i, ts := range d.Time {
+			date, err := time.Parse(historyDateLayout, ts)
+			if err != nil {
+				continue
+			}
+			condition, description, icon := describeWeatherCode(intAt(d.WeatherCode, i))
+			history = append(history, models.HistoryEntry{
+				Date:          date,
+				MaxTemp:       convertTemperature(valueAt(d.MaxTemp, i), units),
+				MinTemp:       convertTemperature(valueAt(d.MinTemp, i), units),
+				AvgTemp:       convertTemperature(valueAt(d.MeanTemp, i), units),
+				Condition:     condition,
+				Description:   description,
+				Icon:          icon,
+				Humidity:      percentAt(d.Humidity, i),
+				WindSpeed:     valueAt(d.WindSpeed, i),
+				Precipitation: valueAt(d.Precipitation, i),
+			})
+		}
+	}
+
+	return &models.WeatherHistory{
+		Forecast:    history,
+		RequestTime: time.Now(),
+	}
+}
+
+// convertTemperature converts a Celsius value to kelvin when requested, keeping gaps as nil.
+// Fahrenheit is requested from Open-Meteo directly, so metric and imperial pass through.
+func convertTemperature(value *float64, units string) *float64 {
+	if value == nil || units != "kelvin" {
+		return value
+	}
+	kelvin := *value + 273.15
+	return &kelvin
+}
+
+// valueAt returns the value at index i of a series, or nil for gaps
+func valueAt(series []*float64, i int) *float64 {
+	if i >= len(series) {
+		return nil
+	}
+	return series[i]
+}
+
+// percentAt returns the value at index i of a percentage series rounded to a whole number, or nil for gaps
+func percentAt(series []*float64, i int) *int {
+	value := valueAt(series, i)
+	if value == nil {
+		return nil
+	}
+	percent := int(math.Round(*value))
+	return &percent
+}
+
+// intAt returns the value at index i of an integer series, or -1 for gaps
+func intAt(series []*int, i int) int {
+	if i >= len(series) || series[i] == nil {
+		return -1
+	}
+	return *series[i]
+}
+
+// describeWeatherCode maps a WMO weather code to OpenWeatherMap-style condition, description and icon
+func describeWeatherCode(code int) (string, string, string) {
+	switch {
+	case code == 0:
+		return "Clear", "Clear Sky", "01d"
+	case code == 1:
+		return "Clouds", "Mainly Clear", "02d"
+	case code == 2:
+		return "Clouds", "Partly Cloudy", "03d"
+	case code == 3:
+		return "Clouds", "Overcast", "04d"
+	case code == 45 || code == 48:
+		return "Fog", "Fog", "50d"
+	case code >= 51 && code <= 57:
+		return "Drizzle", "Drizzle", "09d"
+	case code >= 61 && code <= 67:
+		return "Rain", "Rain", "10d"
+	case code >= 71 && code <= 77:
+		return "Snow", "Snow", "13d"
+	case code >= 80 && code <= 82:
+		return "Rain", "Rain Showers", "09d"
+	case code == 85 || code == 86:
+		return "Snow", "Snow Showers", "13d"
+	case code >= 95 && code <= 99:
+		return "Thunderstorm", "Thunderstorm", "11d"
+	default:
+		return "", "", ""
+	}
+}
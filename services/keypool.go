@@ -0,0 +1,210 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"weathering-with-go/metrics"
+	"weathering-with-go/redact"
+)
+
+// Key rotation strategies
+const (
+	// RotationRoundRobin takes the available keys in turn
+	RotationRoundRobin = "round-robin"
+	// RotationRemainingQuota takes the available key with the most calls left today
+	RotationRemainingQuota = "remaining-quota"
+)
+
+// DefaultKeyBenchDuration is how long a key rejected by the provider is taken out of rotation
+const DefaultKeyBenchDuration = 5 * time.Minute
+
+// ErrNoUpstreamKeys is returned when every upstream API key is benched or out of quota
+var ErrNoUpstreamKeys = errors.New("upstream API keys unavailable")
+
+// poolKey is one upstream key and its usage today
+type poolKey struct {
+	key          string
+	day          string // UTC day the call count belongs to
+	calls        int
+	benchedUntil time.Time
+}
+
+// KeyPool hands out the server's OpenWeatherMap keys, rotating among them and benching a key
+// for a while when the provider rejects it (401) or throttles it (429)
+type KeyPool struct {
+	mu         sync.Mutex
+	keys       []*poolKey
+	strategy   string
+	dailyQuota int // calls per key per UTC day; 0 is unlimited
+	benchFor   time.Duration
+	next       int // round-robin cursor
+
+	Logger *slog.Logger // optional; defaults to slog.Default()
+	now    func() time.Time
+}
+
+// NewKeyPool creates a pool over keys. strategy is RotationRoundRobin or RotationRemainingQuota;
+// dailyQuota is the calls each key may make per UTC day (0 is unlimited).
+func NewKeyPool(keys []string, strategy string, dailyQuota int, benchFor time.Duration) *KeyPool {
+	if benchFor <= 0 {
+		benchFor = DefaultKeyBenchDuration
+	}
+
+	p := &KeyPool{
+		strategy:   strategy,
+		dailyQuota: dailyQuota,
+		benchFor:   benchFor,
+		now:        time.Now,
+	}
+	p.SetKeys(keys)
+	return p
+}
+
+// SetKeys replaces the keys in rotation. Keys that stay keep their usage and bench state.
+func (p *KeyPool) SetKeys(keys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*poolKey, len(p.keys))
+	for _, k := range p.keys {
+		existing[k.key] = k
+	}
+
+	p.keys = p.keys[:0:0]
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if k, ok := existing[key]; ok {
+			p.keys = append(p.keys, k)
+			delete(existing, key)
+			continue
+		}
+		p.keys = append(p.keys, &poolKey{key: key})
+	}
+	p.next = 0
+}
+
+// SetStrategy switches how keys are picked, RotationRoundRobin or RotationRemainingQuota. Usage
+// and bench state are kept.
+func (p *KeyPool) SetStrategy(strategy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strategy = strategy
+}
+
+// Len returns the number of keys in rotation, including benched ones
+func (p *KeyPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
+// Available returns the number of keys that can take a call now, being neither benched nor at
+// their daily quota
+func (p *KeyPool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	today := now.UTC().Format("2006-01-02")
+	available := 0
+	for _, k := range p.keys {
+		if now.Before(k.benchedUntil) || (p.dailyQuota > 0 && k.day == today && k.calls >= p.dailyQuota) {
+			continue
+		}
+		available++
+	}
+	return available
+}
+
+// Next picks the key for an upstream call and counts the call against it, or returns
+// ErrNoUpstreamKeys when none is available
+func (p *KeyPool) Next() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	today := now.UTC().Format("2006-01-02")
+
+	var picked *poolKey
+	for i := range p.keys {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if k.day != today {
+			k.day, k.calls = today, 0
+		}
+		if now.Before(k.benchedUntil) || (p.dailyQuota > 0 && k.calls >= p.dailyQuota) {
+			continue
+		}
+
+		if p.strategy != RotationRemainingQuota {
+			picked = k
+			break
+		}
+		// Most calls left today; with no quota that is the least used key. Ties go to the
+		// key after the cursor, so equally used keys still take turns.
+		if picked == nil || k.calls < picked.calls {
+			picked = k
+		}
+	}
+	if picked == nil {
+		return "", ErrNoUpstreamKeys
+	}
+
+	for i, k := range p.keys {
+		if k == picked {
+			p.next = (i + 1) % len(p.keys)
+		}
+	}
+	picked.calls++
+	return picked.key, nil
+}
+
+// Release gives back a call counted by Next that never went out, such as one refused by the
+// caller's own quota, so it does not use up the key
+func (p *KeyPool) Release(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	today := p.now().UTC().Format("2006-01-02")
+	for _, k := range p.keys {
+		if k.key == key && k.day == today && k.calls > 0 {
+			k.calls--
+			return
+		}
+	}
+}
+
+// Report records the provider's response to a call made with key, benching the key when it
+// was rejected or throttled. Keys not in the pool, such as callers' own, are ignored.
+func (p *KeyPool) Report(key string, status int) {
+	if status != http.StatusUnauthorized && status != http.StatusTooManyRequests {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, k := range p.keys {
+		if k.key != key {
+			continue
+		}
+		k.benchedUntil = p.now().Add(p.benchFor)
+		metrics.UpstreamKeyBenches.WithLabelValues(strconv.Itoa(status)).Inc()
+		p.logger().Warn("benched upstream API key", "key", redact.Secret(key), "status", status, "until", k.benchedUntil.UTC().Format(time.RFC3339))
+		return
+	}
+}
+
+// logger returns the pool logger
+func (p *KeyPool) logger() *slog.Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+	return slog.Default()
+}
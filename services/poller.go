@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"weathering-with-go/metrics"
+	"weathering-with-go/models"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultPollInterval    = 10 * time.Minute
+	DefaultPollConcurrency = 4
+	// PollJitter is the fraction of an interval by which each refresh is randomly shifted
+	PollJitter = 0.1
+)
+
+// WatchedLocation is a location refreshed in the background on its own interval
+type WatchedLocation struct {
+	Location string
+	Units    string
+	Interval time.Duration
+}
+
+// WatchStatus reports the refresh state of a watched location
+type WatchStatus struct {
+	Location    string    `json:"location"`
+	Units       string    `json:"units"`
+	Interval    string    `json:"interval"`
+	LastRefresh time.Time `json:"last_refresh,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextRefresh time.Time `json:"next_refresh,omitempty"`
+	Refreshes   int       `json:"refreshes"`
+	Failures    int       `json:"failures"`
+	Fresh       bool      `json:"fresh"`
+}
+
+// watchTarget holds the schedule and latest result for one watched location
+type watchTarget struct {
+	WatchedLocation
+	status WatchStatus
+	latest *models.WeatherData
+}
+
+// Poller keeps current weather for a fixed set of locations fresh in memory.
+// Each location is scheduled independently with jitter, and refreshes are executed by a
+// bounded pool of workers so upstream concurrency never exceeds the configured limit.
+type Poller struct {
+	service     *WeatherService
+	concurrency int
+
+	mu      sync.RWMutex
+	targets map[string]*watchTarget
+
+	jobs    chan *watchTarget
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	started bool
+	once    sync.Once
+}
+
+// NewPoller creates a poller for the given locations; call Start to begin refreshing
+func NewPoller(service *WeatherService, locations []WatchedLocation, concurrency int) *Poller {
+	if concurrency <= 0 {
+		concurrency = DefaultPollConcurrency
+	}
+
+	p := &Poller{
+		service:     service,
+		concurrency: concurrency,
+		targets:     make(map[string]*watchTarget),
+		jobs:        make(chan *watchTarget),
+		stop:        make(chan struct{}),
+	}
+
+	for _, loc := range locations {
+		if loc.Units == "" {
+			loc.Units = DefaultUnits
+		}
+		if loc.Interval <= 0 {
+			loc.Interval = DefaultPollInterval
+		}
+		p.targets[watchKey(loc.Location, loc.Units)] = &watchTarget{
+			WatchedLocation: loc,
+			status: WatchStatus{
+				Location: loc.Location,
+				Units:    loc.Units,
+				Interval: loc.Interval.String(),
+			},
+		}
+	}
+
+	return p
+}
+
+// Start launches the worker pool and one scheduler per watched location
+func (p *Poller) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started {
+		return
+	}
+	p.started = true
+
+	for i := 0; i < p.concurrency; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+
+	for _, target := range p.targets {
+		p.wg.Add(1)
+		go p.schedule(target)
+	}
+}
+
+// Stop halts scheduling, waits for in-flight refreshes to finish and returns
+func (p *Poller) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+	})
+}
+
+// Latest returns the most recent result for a watched location if it is still fresh
+func (p *Poller) Latest(location, units string) (*models.WeatherData, bool) {
+	if units == "" {
+		units = DefaultUnits
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	target, ok := p.targets[watchKey(location, units)]
+	if !ok || target.latest == nil || !target.fresh() {
+		return nil, false
+	}
+
+	// Hand out a copy so callers never share the cached value
+	data := *target.latest
+	return &data, true
+}
+
+// Statuses returns the refresh state of every watched location, sorted by location
+func (p *Poller) Statuses() []WatchStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	statuses := make([]WatchStatus, 0, len(p.targets))
+	for _, target := range p.targets {
+		status := target.status
+		status.Fresh = target.latest != nil && target.fresh()
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Location == statuses[j].Location {
+			return statuses[i].Units < statuses[j].Units
+		}
+		return statuses[i].Location < statuses[j].Location
+	})
+	return statuses
+}
+
+// Status returns the refresh state of a single watched location
+func (p *Poller) Status(location, units string) (WatchStatus, bool) {
+	if units == "" {
+		units = DefaultUnits
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	target, ok := p.targets[watchKey(location, units)]
+	if !ok {
+		return WatchStatus{}, false
+	}
+	status := target.status
+	status.Fresh = target.latest != nil && target.fresh()
+	return status, true
+}
+
+// schedule enqueues refreshes for one target: first after a random initial delay, then every
+// interval with jitter, so locations sharing an interval do not all hit upstream together
+func (p *Poller) schedule(target *watchTarget) {
+	defer p.wg.Done()
+
+	delay := time.Duration(rand.Int63n(int64(target.Interval)/10 + 1))
+	for {
+		p.setNextRefresh(target, time.Now().Add(delay))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-p.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case p.jobs <- target:
+		}
+
+		delay = jitter(target.Interval)
+	}
+}
+
+// worker executes refresh jobs until the poller is stopped
+func (p *Poller) worker() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case target := <-p.jobs:
+			p.refresh(target)
+		}
+	}
+}
+
+// refresh fetches current weather for a target and records the outcome
+func (p *Poller) refresh(target *watchTarget) {
+	ctx, cancel := context.WithTimeout(WithClientID(context.Background(), PollerClientID), DefaultTimeout)
+	defer cancel()
+
+	ctx, span := startSpan(ctx, "Poller.refresh", trace.SpanKindInternal, attrLocation.String(target.Location), attrUnits.String(target.Units))
+	data, err := p.service.fetchCurrentWeather(ctx, target.Location, target.Units)
+	endSpan(span, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	target.status.LastRefresh = now
+	target.status.Refreshes++
+	if err != nil {
+		metrics.PollerRefreshes.WithLabelValues("failure").Inc()
+		target.status.Failures++
+		target.status.LastError = err.Error()
+		p.service.logger().Warn("failed to refresh watched location", "location", target.Location, "units", target.Units, "error", err)
+		return
+	}
+
+	metrics.PollerRefreshes.WithLabelValues("success").Inc()
+	target.status.LastSuccess = now
+	target.status.LastError = ""
+	target.latest = data
+}
+
+// setNextRefresh records when a target is next due
+func (p *Poller) setNextRefresh(target *watchTarget, next time.Time) {
+	p.mu.Lock()
+	target.status.NextRefresh = next
+	p.mu.Unlock()
+}
+
+// fresh reports whether the latest result is recent enough to serve; a single missed
+// refresh is tolerated before requests fall back to upstream. Callers must hold the lock.
+func (t *watchTarget) fresh() bool {
+	return time.Since(t.status.LastSuccess) <= 2*t.Interval
+}
+
+// jitter shifts an interval randomly by up to PollJitter in either direction
+func jitter(interval time.Duration) time.Duration {
+	spread := int64(float64(interval) * PollJitter)
+	if spread <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(2*spread+1)-spread)
+}
+
+// watchKey normalises a location and units pair for lookups
+func watchKey(location, units string) string {
+	return strings.ToLower(strings.TrimSpace(location)) + "|" + units
+}
@@ -1,6 +1,15 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -36,3 +45,428 @@ func TestCalculateDailyForecastEmpty(t *testing.T) {
 		t.Fatalf("expected non-zero date")
 	}
 }
+
+func TestConvertHistoryResponseDaily(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	max, min, mean, rain := 18.5, 9.0, 13.2, 1.4
+	code := 61
+	archive := models.OpenMeteoArchiveResponse{
+		Daily: &models.OpenMeteoDaily{
+			Time:          []string{"2026-03-01"},
+			MaxTemp:       []*float64{&max},
+			MinTemp:       []*float64{&min},
+			MeanTemp:      []*float64{&mean},
+			Precipitation: []*float64{&rain},
+			WeatherCode:   []*int{&code},
+		},
+	}
+
+	data := svc.convertHistoryResponse(archive, "kelvin")
+	if len(data.Forecast) != 1 {
+		t.Fatalf("expected 1 day got %d", len(data.Forecast))
+	}
+	day := data.Forecast[0]
+	if day.Date.Format("2006-01-02") != "2026-03-01" {
+		t.Fatalf("unexpected date %s", day.Date)
+	}
+	if day.MaxTemp == nil || *day.MaxTemp != max+273.15 {
+		t.Fatalf("expected kelvin max temperature got %v", day.MaxTemp)
+	}
+	if day.Condition != "Rain" || day.Precipitation == nil || *day.Precipitation != rain {
+		t.Fatalf("unexpected condition/precipitation: %s %v", day.Condition, day.Precipitation)
+	}
+	if day.Humidity != nil {
+		t.Fatalf("missing humidity series should be omitted, got %d", *day.Humidity)
+	}
+}
+
+func TestConvertHistoryResponseHourlyGaps(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	temp, humidity := 4.0, 87.6
+	archive := models.OpenMeteoArchiveResponse{
+		Hourly: &models.OpenMeteoHourly{
+			Time:          []string{"2026-03-01T00:00", "2026-03-01T01:00"},
+			Temperature:   []*float64{&temp, nil},
+			Humidity:      []*float64{&humidity, nil},
+			Precipitation: []*float64{nil, nil},
+			WeatherCode:   []*int{nil, nil},
+		},
+	}
+
+	data := svc.convertHistoryResponse(archive, "metric")
+	if len(data.Forecast) != 2 {
+		t.Fatalf("expected 2 hours got %d", len(data.Forecast))
+	}
+	first, second := data.Forecast[0], data.Forecast[1]
+	if first.AvgTemp == nil || *first.AvgTemp != temp || first.Humidity == nil || *first.Humidity != 88 {
+		t.Fatalf("unexpected first hour: %+v", first)
+	}
+	if first.Precipitation != nil || first.Condition != "" {
+		t.Fatalf("null precipitation and weather code should be omitted: %+v", first)
+	}
+	if second.AvgTemp != nil || second.Humidity != nil || second.WindSpeed != nil {
+		t.Fatalf("null readings should be omitted, not reported as zero: %+v", second)
+	}
+
+	body, err := json.Marshal(second)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(body), "temperature") || strings.Contains(string(body), "precipitation") {
+		t.Fatalf("expected missing readings to be absent from JSON, got %s", body)
+	}
+}
+
+type memoryObservations struct {
+	recorded []models.Observation
+}
+
+func (m *memoryObservations) Record(obs models.Observation) error {
+	m.recorded = append(m.recorded, obs)
+	return nil
+}
+
+func (m *memoryObservations) Query(location, units string, from, to time.Time) ([]models.Observation, error) {
+	return m.recorded, nil
+}
+
+func TestRecordObservationUsesUpstreamTimestamp(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	mem := &memoryObservations{}
+	svc.Observations = mem
+
+	updated := time.Unix(1234567890, 0)
+	svc.recordObservation("Testville", "metric", &models.WeatherData{
+		Current:     models.Current{Temperature: 12, LastUpdated: updated},
+		RequestTime: time.Now(),
+	})
+
+	if len(mem.recorded) != 1 {
+		t.Fatalf("expected 1 recorded observation got %d", len(mem.recorded))
+	}
+	if !mem.recorded[0].ObservedAt.Equal(updated) {
+		t.Fatalf("expected observation time %s got %s", updated, mem.recorded[0].ObservedAt)
+	}
+}
+
+func TestGetObservationsWithoutStore(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	if _, err := svc.GetObservations("Testville", "metric", time.Now().Add(-time.Hour), time.Now()); err != ErrObservationsDisabled {
+		t.Fatalf("expected ErrObservationsDisabled got %v", err)
+	}
+}
+
+func TestPollerServesWatchedLocation(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	p := NewPoller(svc, []WatchedLocation{{Location: "Testville", Interval: time.Minute}}, 1)
+	svc.Poller = p
+
+	if _, ok := p.Latest("Testville", "metric"); ok {
+		t.Fatalf("expected no result before the first refresh")
+	}
+
+	// Simulate a completed refresh
+	target := p.targets[watchKey("Testville", "metric")]
+	target.latest = &models.WeatherData{Location: models.Location{Name: "Testville"}}
+	target.status.LastSuccess = time.Now()
+
+	ctx, info := WithCallInfo(context.Background())
+	data, err := svc.GetCurrentWeather(ctx, " testville ", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.Location.Name != "Testville" {
+		t.Fatalf("expected watched result got %+v", data.Location)
+	}
+	if info.Cache() != CacheHit || info.Providers() != "" {
+		t.Fatalf("expected a cache hit without upstream calls, got %q %q", info.Cache(), info.Providers())
+	}
+
+	// Unwatched locations go upstream (the cancelled context stops the call before it leaves)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx, info = WithCallInfo(cancelled)
+	if _, err := svc.GetCurrentWeather(ctx, "Elsewhere", ""); err == nil {
+		t.Fatalf("expected the cancelled upstream call to fail")
+	}
+	if info.Cache() != CacheMiss || info.Providers() != ProviderOpenWeatherMap {
+		t.Fatalf("expected a cache miss served by %s, got %q %q", ProviderOpenWeatherMap, info.Cache(), info.Providers())
+	}
+
+	statuses := p.Statuses()
+	if len(statuses) != 1 || !statuses[0].Fresh || statuses[0].Interval != "1m0s" {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+
+	p.Start()
+	p.Stop()
+}
+
+func TestJitterStaysWithinBounds(t *testing.T) {
+	interval := 10 * time.Minute
+	for i := 0; i < 100; i++ {
+		d := jitter(interval)
+		if d < 9*time.Minute || d > 11*time.Minute {
+			t.Fatalf("jittered interval %s out of bounds", d)
+		}
+	}
+}
+
+func TestGetBatchHonoursDeadline(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outcomes := svc.GetBatch(ctx, BatchTypeCurrent, []models.WeatherRequest{{Location: "A1"}, {Location: "B2"}}, 1)
+	if len(outcomes) != 2 {
+		t.Fatalf("expected 2 outcomes got %d", len(outcomes))
+	}
+	for i, outcome := range outcomes {
+		if !errors.Is(outcome.Err, context.Canceled) {
+			t.Fatalf("expected item %d to fail with context.Canceled got %v", i, outcome.Err)
+		}
+	}
+}
+
+func TestBuildComparisonAlignsDays(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	current := []*models.WeatherData{
+		{Current: models.Current{Temperature: 10, WindSpeed: 2}},
+		{Current: models.Current{Temperature: 14.5, WindSpeed: 5}},
+	}
+	forecast := []*models.WeatherData{
+		{Forecast: []models.Forecast{{Date: day2, AvgTemp: 11}, {Date: day1, AvgTemp: 9, Precipitation: 1}}},
+		{Forecast: []models.Forecast{{Date: day1, AvgTemp: 12, Precipitation: 4}}},
+	}
+
+	cmp := buildComparison([]string{"London,UK", "Lisbon,PT"}, "metric", current, forecast)
+	if cmp.Baseline != "London,UK" {
+		t.Fatalf("expected first location as baseline got %s", cmp.Baseline)
+	}
+	if d := cmp.Locations[1].Difference; d.Temperature != 4.5 || d.WindSpeed != 3 {
+		t.Fatalf("unexpected current difference: %+v", d)
+	}
+	if len(cmp.Days) != 2 || !cmp.Days[0].Date.Equal(day1) {
+		t.Fatalf("expected 2 days in date order got %+v", cmp.Days)
+	}
+	if d := cmp.Days[0].Entries[1].Difference; d == nil || d.AvgTemp != 3 || d.Precipitation != 3 {
+		t.Fatalf("unexpected day difference: %+v", d)
+	}
+	if cmp.Days[1].Entries[1].Forecast != nil || cmp.Days[1].Entries[1].Difference != nil {
+		t.Fatalf("expected missing forecast for the second location on day 2")
+	}
+}
+
+// concurrencyTransport fails every request after a short delay, recording the most requests in flight at once
+type concurrencyTransport struct {
+	inFlight, peak atomic.Int32
+}
+
+func (c *concurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return nil, errors.New("unreachable")
+}
+
+func TestCompareLocationsBoundsConcurrency(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	transport := &concurrencyTransport{}
+	svc.HTTPClient = &http.Client{Transport: transport}
+
+	locations := []string{"A1", "B2", "C3", "D4", "E5", "F6", "G7", "H8", "I9", "J10"}
+	if _, err := svc.CompareLocations(context.Background(), locations, "metric", 3); err == nil {
+		t.Fatalf("expected the failing upstream to fail the comparison")
+	}
+	if peak := transport.peak.Load(); peak > DefaultBatchConcurrency {
+		t.Fatalf("expected at most %d upstream calls at once, got %d", DefaultBatchConcurrency, peak)
+	}
+}
+
+func TestUsageTrackerQuotasAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	tracker, err := NewUsageTracker(path, 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	ctx := WithClientID(context.Background(), "key:dashboard")
+	for i := 0; i < 2; i++ {
+		if err := tracker.Reserve(ctx, "weather"); err != nil {
+			t.Fatalf("call %d: unexpected error: %v", i, err)
+		}
+	}
+	if err := tracker.Reserve(ctx, "forecast"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded got %v", err)
+	}
+	if err := tracker.Reserve(WithClientID(context.Background(), PollerClientID), "weather"); err != nil {
+		t.Fatalf("system clients should not be held to quotas: %v", err)
+	}
+
+	report := tracker.Usage("key:dashboard")
+	if report.Daily.Calls != 2 || report.Daily.Remaining == nil || *report.Daily.Remaining != 0 || report.Endpoints["weather"] != 2 || report.Endpoints["forecast"] != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// A used-up window says so, while an unlimited one leaves remaining out
+	daily, _ := json.Marshal(report.Daily)
+	monthly, _ := json.Marshal(report.Monthly)
+	if !strings.Contains(string(daily), `"remaining":0`) || strings.Contains(string(monthly), `"remaining"`) {
+		t.Fatalf("unexpected windows: %s %s", daily, monthly)
+	}
+
+	// The daily window resets at midnight UTC; the monthly one does not
+	now = now.Add(2 * time.Hour)
+	if err := tracker.Reserve(ctx, "weather"); err != nil {
+		t.Fatalf("expected a fresh daily quota got %v", err)
+	}
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	reloaded, err := NewUsageTracker(path, 2, 0)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	defer reloaded.Close()
+	reloaded.now = func() time.Time { return now }
+	if report := reloaded.Usage("key:dashboard"); report.Monthly.Calls != 3 || report.Daily.Calls != 1 || report.Total != 3 {
+		t.Fatalf("expected persisted counters got %+v", report)
+	}
+
+	// Reports do not create counters, and clients idle since an earlier month are forgotten
+	reloaded.Usage("ip:198.51.100.1")
+	if err := reloaded.Reserve(WithClientID(context.Background(), "ip:198.51.100.2"), "weather"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.AddDate(0, 1, 0)
+	if err := reloaded.Reserve(ctx, "weather"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed := reloaded.Prune(); removed != 2 {
+		t.Fatalf("expected the idle client and poller pruned got %d", removed)
+	}
+	if _, ok := reloaded.clients["ip:198.51.100.2"]; ok || len(reloaded.clients) != 1 {
+		t.Fatalf("expected only the active client to remain, got %d clients", len(reloaded.clients))
+	}
+}
+
+func TestKeyPoolRotation(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+
+	roundRobin := NewKeyPool([]string{"a", "b", "c"}, RotationRoundRobin, 0, time.Minute)
+	roundRobin.now = func() time.Time { return now }
+	var picked []string
+	for i := 0; i < 4; i++ {
+		key, _ := roundRobin.Next()
+		picked = append(picked, key)
+	}
+	if strings.Join(picked, ",") != "a,b,c,a" {
+		t.Fatalf("unexpected round-robin order %v", picked)
+	}
+
+	// A throttled key sits out until its bench expires
+	roundRobin.Report("b", http.StatusTooManyRequests)
+	roundRobin.Report("caller-key", http.StatusUnauthorized)
+	if n := roundRobin.Available(); n != 2 {
+		t.Fatalf("expected 2 available keys with one benched, got %d", n)
+	}
+	picked = picked[:0]
+	for i := 0; i < 3; i++ {
+		key, _ := roundRobin.Next()
+		picked = append(picked, key)
+	}
+	if strings.Join(picked, ",") != "c,a,c" {
+		t.Fatalf("expected the benched key to be skipped, got %v", picked)
+	}
+	now = now.Add(time.Minute)
+	roundRobin.Next()
+	if key, _ := roundRobin.Next(); key != "b" {
+		t.Fatalf("expected the key to return after its bench, got %s", key)
+	}
+
+	// Remaining quota prefers the least used key and stops at the daily quota
+	byQuota := NewKeyPool([]string{"a", "b"}, RotationRemainingQuota, 2, time.Minute)
+	byQuota.now = func() time.Time { return now }
+	byQuota.SetKeys([]string{"a"})
+	byQuota.Next()
+	byQuota.SetKeys([]string{"a", "b"})
+	picked = picked[:0]
+	for i := 0; i < 3; i++ {
+		key, _ := byQuota.Next()
+		picked = append(picked, key)
+	}
+	if strings.Join(picked, ",") != "b,a,b" {
+		t.Fatalf("unexpected remaining-quota order %v", picked)
+	}
+	if _, err := byQuota.Next(); !errors.Is(err, ErrNoUpstreamKeys) || byQuota.Available() != 0 {
+		t.Fatalf("expected every key to be out of quota, got %v", err)
+	}
+
+	// Quotas reset at midnight UTC
+	now = now.Add(time.Hour)
+	if _, err := byQuota.Next(); err != nil {
+		t.Fatalf("expected quotas to reset, got %v", err)
+	}
+
+	// Switching strategy keeps usage: round-robin now takes the next key in turn, not the least used
+	byQuota.SetStrategy(RotationRoundRobin)
+	byQuota.SetKeys([]string{"a", "b"})
+	if key, _ := byQuota.Next(); key != "a" {
+		t.Fatalf("expected round-robin after switching strategy, got %s", key)
+	}
+}
+
+// okTransport answers every request with an empty JSON object, counting the calls
+type okTransport struct {
+	calls atomic.Int32
+}
+
+func (o *okTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	o.calls.Add(1)
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Header: make(http.Header), Request: req}, nil
+}
+
+func TestClientOverQuotaDoesNotSpendKeyPool(t *testing.T) {
+	svc := NewWeatherService("dummy")
+	transport := &okTransport{}
+	svc.HTTPClient = &http.Client{Transport: transport}
+	svc.Keys = NewKeyPool([]string{"server-key"}, RotationRoundRobin, 3, time.Minute)
+	tracker, err := NewUsageTracker("", 1, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer tracker.Close()
+	svc.Usage = tracker
+
+	greedy := WithClientID(context.Background(), "ip:203.0.113.7")
+	if _, err := svc.fetchCurrentWeather(greedy, "London", "metric"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := svc.fetchCurrentWeather(greedy, "London", "metric"); !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("call %d: expected ErrQuotaExceeded got %v", i, err)
+		}
+	}
+	if n := transport.calls.Load(); n != 1 {
+		t.Fatalf("expected one upstream call, got %d", n)
+	}
+
+	// Refused calls were given back, so the key still has quota for other clients
+	for i := 0; i < 2; i++ {
+		other := WithClientID(context.Background(), fmt.Sprintf("ip:198.51.100.%d", i))
+		if _, err := svc.fetchCurrentWeather(other, "Paris", "metric"); err != nil {
+			t.Fatalf("client %d: expected the pool to have quota left, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies spans created by the services package
+const tracerName = "weathering-with-go/services"
+
+// Span attribute keys shared by service spans
+const (
+	attrLocation = attribute.Key("weather.location")
+	attrUnits    = attribute.Key("weather.units")
+	attrProvider = attribute.Key("weather.provider")
+	attrEndpoint = attribute.Key("weather.endpoint")
+	attrCache    = attribute.Key("weather.cache")
+)
+
+// startSpan starts a span from the global tracer provider, a no-op unless tracing is configured
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"weathering-with-go/metrics"
+	"weathering-with-go/models"
+)
+
+const (
+	// UsageFlushInterval is how often changed usage counters are written to disk
+	UsageFlushInterval = 30 * time.Second
+	// SystemClientPrefix marks internal callers, which are counted but never held to quotas
+	SystemClientPrefix = "system:"
+	// PollerClientID identifies upstream calls made by the background poller
+	PollerClientID = SystemClientPrefix + "poller"
+	// ProbeClientID identifies upstream calls made by readiness checks
+	ProbeClientID = SystemClientPrefix + "probe"
+
+	usageDayLayout   = "2006-01-02"
+	usageMonthLayout = "2006-01"
+)
+
+// ErrQuotaExceeded is returned when a client has used up its upstream call quota
+var ErrQuotaExceeded = errors.New("upstream quota exceeded")
+
+type clientIDKey struct{}
+
+// WithClientID returns a context that attributes upstream calls to client
+func WithClientID(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientIDKey{}, client)
+}
+
+// ClientIDFromContext returns the client upstream calls are attributed to
+func ClientIDFromContext(ctx context.Context) string {
+	if client, ok := ctx.Value(clientIDKey{}).(string); ok && client != "" {
+		return client
+	}
+	return "anonymous"
+}
+
+// clientUsage holds one client's counters for the current day and month
+type clientUsage struct {
+	Day        string         `json:"day"`
+	DayCalls   int            `json:"day_calls"`
+	Month      string         `json:"month"`
+	MonthCalls int            `json:"month_calls"`
+	Endpoints  map[string]int `json:"endpoints"` // this month, per upstream endpoint
+	Total      int64          `json:"total"`
+}
+
+// UsageTracker counts upstream calls per client and endpoint, enforces daily and monthly
+// quotas (UTC calendar windows) and persists counters to a JSON file across restarts
+type UsageTracker struct {
+	mu           sync.Mutex
+	path         string
+	dailyQuota   int // 0 means unlimited
+	monthlyQuota int // 0 means unlimited
+	clients      map[string]*clientUsage
+	dirty        bool
+	now          func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewUsageTracker creates a tracker, loading counters from path when it exists.
+// An empty path keeps counters in memory only.
+func NewUsageTracker(path string, dailyQuota, monthlyQuota int) (*UsageTracker, error) {
+	t := &UsageTracker{
+		path:         path,
+		dailyQuota:   dailyQuota,
+		monthlyQuota: monthlyQuota,
+		clients:      make(map[string]*clientUsage),
+		now:          time.Now,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read usage file: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &t.clients); err != nil {
+				return nil, fmt.Errorf("failed to parse usage file: %w", err)
+			}
+		}
+	}
+
+	go t.flushLoop()
+	return t, nil
+}
+
+// Reserve counts one upstream call for the client in ctx, or returns ErrQuotaExceeded
+// without counting it when the client's daily or monthly quota is used up
+func (t *UsageTracker) Reserve(ctx context.Context, endpoint string) error {
+	client := ClientIDFromContext(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage := t.current(client)
+	if !strings.HasPrefix(client, SystemClientPrefix) {
+		if t.dailyQuota > 0 && usage.DayCalls >= t.dailyQuota {
+			metrics.QuotaRejections.WithLabelValues("daily").Inc()
+			return fmt.Errorf("daily %w for %s", ErrQuotaExceeded, client)
+		}
+		if t.monthlyQuota > 0 && usage.MonthCalls >= t.monthlyQuota {
+			metrics.QuotaRejections.WithLabelValues("monthly").Inc()
+			return fmt.Errorf("monthly %w for %s", ErrQuotaExceeded, client)
+		}
+	}
+
+	usage.DayCalls++
+	usage.MonthCalls++
+	usage.Endpoints[endpoint]++
+	usage.Total++
+	t.dirty = true
+	return nil
+}
+
+// Usage reports a client's consumption and remaining quota
+func (t *UsageTracker) Usage(client string) models.UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	// Looking up usage never creates counters, so reports cannot grow the tracker
+	usage := &clientUsage{Day: now.Format(usageDayLayout), Month: now.Format(usageMonthLayout)}
+	if _, ok := t.clients[client]; ok {
+		usage = t.current(client)
+	}
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	endpoints := make(map[string]int, len(usage.Endpoints))
+	for endpoint, calls := range usage.Endpoints {
+		endpoints[endpoint] = calls
+	}
+
+	return models.UsageReport{
+		Client:    client,
+		Daily:     usageWindow(usage.Day, usage.DayCalls, t.dailyQuota, dayStart.AddDate(0, 0, 1)),
+		Monthly:   usageWindow(usage.Month, usage.MonthCalls, t.monthlyQuota, monthStart.AddDate(0, 1, 0)),
+		Endpoints: endpoints,
+		Total:     usage.Total,
+	}
+}
+
+// Prune forgets clients that have made no upstream calls this month, so identities seen once do
+// not accumulate in memory or in the usage file. It returns how many clients were removed.
+func (t *UsageTracker) Prune() int {
+	month := t.now().UTC().Format(usageMonthLayout)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removed := 0
+	for client, usage := range t.clients {
+		if usage.Month != month {
+			delete(t.clients, client)
+			removed++
+		}
+	}
+	if removed > 0 {
+		t.dirty = true
+	}
+	return removed
+}
+
+// Flush writes counters to disk if they changed since the last flush
+func (t *UsageTracker) Flush() error {
+	if t.path == "" {
+		return nil
+	}
+
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(t.clients, "", "  ")
+	t.dirty = false
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode usage: %w", err)
+	}
+
+	// Write to a temporary file and rename so a crash never leaves a truncated file
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+
+	return nil
+}
+
+// Close stops the background flusher and writes any pending counters
+func (t *UsageTracker) Close() error {
+	var err error
+	t.once.Do(func() {
+		close(t.stop)
+		<-t.done
+		err = t.Flush()
+	})
+	return err
+}
+
+// current returns the client's counters, resetting windows that have rolled over.
+// Callers must hold the lock.
+func (t *UsageTracker) current(client string) *clientUsage {
+	now := t.now().UTC()
+	day := now.Format(usageDayLayout)
+	month := now.Format(usageMonthLayout)
+
+	usage, ok := t.clients[client]
+	if !ok {
+		usage = &clientUsage{Day: day, Month: month, Endpoints: make(map[string]int)}
+		t.clients[client] = usage
+	}
+	if usage.Endpoints == nil {
+		usage.Endpoints = make(map[string]int)
+	}
+
+	if usage.Day != day {
+		usage.Day = day
+		usage.DayCalls = 0
+	}
+	if usage.Month != month {
+		usage.Month = month
+		usage.MonthCalls = 0
+		usage.Endpoints = make(map[string]int)
+	}
+
+	return usage
+}
+
+// flushLoop periodically prunes and persists counters until the tracker is closed
+func (t *UsageTracker) flushLoop() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(UsageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.Prune()
+			if err := t.Flush(); err != nil {
+				slog.Warn("failed to persist usage counters", "error", err)
+			}
+		}
+	}
+}
+
+// usageWindow builds the report for one quota window
+func usageWindow(period string, calls, quota int, resetsAt time.Time) models.UsageWindow {
+	window := models.UsageWindow{
+		Period:   period,
+		Calls:    calls,
+		Limit:    quota,
+		ResetsAt: resetsAt,
+	}
+	if quota > 0 {
+		remaining := max(quota-calls, 0)
+		window.Remaining = &remaining
+	}
+	return window
+}
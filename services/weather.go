@@ -1,15 +1,28 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"weathering-with-go/metrics"
 	"weathering-with-go/models"
+	"weathering-with-go/redact"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -20,24 +33,107 @@ const (
 	DefaultTimeout         = 10 * time.Second
 )
 
+// urlRedactor masks API keys in upstream URLs recorded on spans
+var urlRedactor = redact.New()
+
+// ErrObservationsDisabled is returned when observation history is requested without a configured store
+var ErrObservationsDisabled = errors.New("observation store is not configured")
+
+// StatusError is returned when an upstream provider answers with a status other than 200
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Body       string // the provider's explanation, usually its response body
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+type upstreamKeyKey struct{}
+
+// WithUpstreamKey returns a context whose OpenWeatherMap calls use the caller's own API key
+func WithUpstreamKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, upstreamKeyKey{}, key)
+}
+
+// hasUpstreamKey reports whether ctx carries a caller-supplied API key
+func hasUpstreamKey(ctx context.Context) bool {
+	key, ok := ctx.Value(upstreamKeyKey{}).(string)
+	return ok && key != ""
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose upstream calls carry the given request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ObservationStore persists current-weather observations for later time-series queries
+type ObservationStore interface {
+	Record(obs models.Observation) error
+	Query(location, units string, from, to time.Time) ([]models.Observation, error)
+}
+
 // WeatherService handles weather data operations
 type WeatherService struct {
-	APIKey     string
-	HTTPClient *http.Client
+	Keys         *KeyPool // the server's own OpenWeatherMap keys
+	HTTPClient   *http.Client
+	Observations ObservationStore // optional; nil disables observation history
+	Poller       *Poller          // optional; serves watched locations from memory
+	Usage        *UsageTracker    // optional; counts upstream calls and enforces quotas
+	Logger       *slog.Logger     // optional; defaults to slog.Default()
+
+	probe    upstreamProbe
+	draining atomic.Bool
 }
 
-// NewWeatherService creates a new weather service instance
+// NewWeatherService creates a new weather service instance calling OpenWeatherMap with apiKey;
+// replace Keys to rotate among several keys
 func NewWeatherService(apiKey string) *WeatherService {
 	return &WeatherService{
-		APIKey: apiKey,
+		Keys: NewKeyPool([]string{apiKey}, RotationRoundRobin, 0, 0),
 		HTTPClient: &http.Client{
 			Timeout: DefaultTimeout,
 		},
 	}
 }
 
-// GetCurrentWeather fetches current weather data for a given location
-func (w *WeatherService) GetCurrentWeather(location, units string, apikey string) (*models.WeatherData, error) {
+// GetCurrentWeather fetches current weather data for a given location.
+// Watched locations are answered from the poller's in-memory results while they are fresh.
+func (w *WeatherService) GetCurrentWeather(ctx context.Context, location, units string) (data *models.WeatherData, err error) {
+	if units == "" {
+		units = DefaultUnits
+	}
+
+	ctx, span := startSpan(ctx, "WeatherService.GetCurrentWeather", trace.SpanKindInternal, attrLocation.String(location), attrUnits.String(units))
+	defer func() { endSpan(span, err) }()
+
+	// Caller-supplied keys always go upstream: their quota is the one spent, and their
+	// results must never be shared with or served from the poller's entries
+	switch {
+	case hasUpstreamKey(ctx):
+		noteCache(ctx, CacheBypass)
+	case w.Poller != nil:
+		if cached, ok := w.Poller.Latest(location, units); ok {
+			noteCache(ctx, CacheHit)
+			return cached, nil
+		}
+		noteCache(ctx, CacheMiss)
+	}
+
+	return w.fetchCurrentWeather(ctx, location, units)
+}
+
+// fetchCurrentWeather fetches current weather data from OpenWeatherMap
+func (w *WeatherService) fetchCurrentWeather(ctx context.Context, location, units string) (*models.WeatherData, error) {
 	if location == "" {
 		return nil, fmt.Errorf("location cannot be empty")
 	}
@@ -46,45 +142,33 @@ func (w *WeatherService) GetCurrentWeather(location, units string, apikey string
 		units = DefaultUnits
 	}
 
+	apiKey, err := w.apiKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build URL
 	endpoint := fmt.Sprintf("%s%s", OpenWeatherMapBaseURL, CurrentWeatherEndpoint)
 	params := url.Values{}
 	params.Add("q", location)
-	if apikey == "" {
-		params.Add("appid", w.APIKey)
-	} else {
-		params.Add("appid", apikey)
-	}
+	params.Add("appid", apiKey)
 	params.Add("units", units)
 
 	fullURL := fmt.Sprintf("%s?%s", endpoint, params.Encode())
 
-	// Make HTTP request
-	resp, err := w.HTTPClient.Get(fullURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch weather data: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
 	var owmResp models.OpenWeatherMapResponse
-	if err := json.NewDecoder(resp.Body).Decode(&owmResp); err != nil {
-		return nil, fmt.Errorf("failed to parse API response: %w", err)
+	if err := w.getJSON(ctx, ProviderOpenWeatherMap, fullURL, "weather", &owmResp); err != nil {
+		return nil, err
 	}
 
 	// Convert to our internal model
 	weatherData := w.convertCurrentWeatherResponse(owmResp)
+	w.recordObservation(location, units, weatherData)
 	return weatherData, nil
 }
 
 // GetWeatherForecast fetches weather forecast data for a given location
-func (w *WeatherService) GetWeatherForecast(location, units string, days int) (*models.WeatherData, error) {
+func (w *WeatherService) GetWeatherForecast(ctx context.Context, location, units string, days int) (data *models.WeatherData, err error) {
 	if location == "" {
 		return nil, fmt.Errorf("location cannot be empty")
 	}
@@ -97,37 +181,214 @@ func (w *WeatherService) GetWeatherForecast(location, units string, days int) (*
 		days = 5 // OpenWeatherMap free tier supports up to 5 days
 	}
 
+	ctx, span := startSpan(ctx, "WeatherService.GetWeatherForecast", trace.SpanKindInternal,
+		attrLocation.String(location), attrUnits.String(units), attribute.Int("weather.days", days))
+	defer func() { endSpan(span, err) }()
+
+	apiKey, err := w.apiKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build URL
 	endpoint := fmt.Sprintf("%s%s", OpenWeatherMapBaseURL, ForecastEndpoint)
 	params := url.Values{}
 	params.Add("q", location)
-	params.Add("appid", w.APIKey)
+	params.Add("appid", apiKey)
 	params.Add("units", units)
 
 	fullURL := fmt.Sprintf("%s?%s", endpoint, params.Encode())
 
+	var owmResp models.OpenWeatherMapForecastResponse
+	if err := w.getJSON(ctx, ProviderOpenWeatherMap, fullURL, "forecast", &owmResp); err != nil {
+		return nil, err
+	}
+
+	// Convert to our internal model
+	weatherData := w.convertForecastResponse(owmResp, days)
+	return weatherData, nil
+}
+
+// GetObservations returns stored current-weather observations for a location between from and to
+func (w *WeatherService) GetObservations(location, units string, from, to time.Time) (*models.ObservationSeries, error) {
+	if w.Observations == nil {
+		return nil, ErrObservationsDisabled
+	}
+
+	if units == "" {
+		units = DefaultUnits
+	}
+
+	observations, err := w.Observations.Query(location, units, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observations: %w", err)
+	}
+
+	return &models.ObservationSeries{
+		Location:     location,
+		Units:        units,
+		From:         from,
+		To:           to,
+		Count:        len(observations),
+		Observations: observations,
+	}, nil
+}
+
+// recordObservation stores a current-weather result; failures are logged and never fail the request
+func (w *WeatherService) recordObservation(location, units string, data *models.WeatherData) {
+	if w.Observations == nil {
+		return
+	}
+
+	observedAt := data.Current.LastUpdated
+	if observedAt.IsZero() || observedAt.Unix() == 0 {
+		observedAt = data.RequestTime
+	}
+
+	obs := models.Observation{
+		Location:   location,
+		Units:      units,
+		ObservedAt: observedAt,
+		Current:    data.Current,
+	}
+	if err := w.Observations.Record(obs); err != nil {
+		w.logger().Warn("failed to record observation", "location", location, "units", units, "error", err)
+	}
+}
+
+// apiKey returns the OpenWeatherMap key for a request: the caller's own key when supplied,
+// otherwise the next one from our pool
+func (w *WeatherService) apiKey(ctx context.Context) (string, error) {
+	if key, ok := ctx.Value(upstreamKeyKey{}).(string); ok && key != "" {
+		return key, nil
+	}
+	return w.Keys.Next()
+}
+
+// pooledKey returns the server key a call to fullURL is made with, or "" when it uses none
+func (w *WeatherService) pooledKey(ctx context.Context, provider, fullURL string) string {
+	if provider != ProviderOpenWeatherMap || hasUpstreamKey(ctx) {
+		return ""
+	}
+	u, err := url.Parse(fullURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("appid")
+}
+
+// logger returns the service logger
+func (w *WeatherService) logger() *slog.Logger {
+	if w.Logger != nil {
+		return w.Logger
+	}
+	return slog.Default()
+}
+
+// getJSON performs a GET request against an upstream provider and decodes the JSON body into out.
+// what names the kind of data being fetched; it appears in errors, logs and usage counters.
+func (w *WeatherService) getJSON(ctx context.Context, provider, fullURL, what string, out interface{}) (err error) {
+	// Our key was counted against the pool when the URL was built; give the call back if it
+	// never goes out, so clients over their quota cannot use up the pool
+	pooledKey := w.pooledKey(ctx, provider, fullURL)
+	sent := false
+	defer func() {
+		if !sent && pooledKey != "" {
+			w.Keys.Release(pooledKey)
+		}
+	}()
+
+	// Calls made with a caller's own key do not spend our upstream quota
+	if w.Usage != nil && !hasUpstreamKey(ctx) {
+		if err := w.Usage.Reserve(ctx, what); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build %s request: %w", what, err)
+	}
+
+	// Client span for the upstream call; the URL attribute is redacted since the query carries the API key
+	ctx, span := startSpan(ctx, "GET "+provider+" "+what, trace.SpanKindClient,
+		attrProvider.String(provider),
+		attrEndpoint.String(what),
+		attribute.String("http.request.method", http.MethodGet),
+		attribute.String("server.address", req.URL.Hostname()),
+		attribute.String("url.full", urlRedactor.URL(fullURL)),
+	)
+	defer func() { endSpan(span, err) }()
+	req = req.WithContext(ctx)
+
+	// Propagate the trace context and request ID so upstream logs can be correlated
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	requestID := RequestIDFromContext(ctx)
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	noteProvider(ctx, provider)
+
+	// The URL is never logged: its query string carries the API key
+	logger := w.logger().With(
+		"provider", provider,
+		"endpoint", what,
+		"request_id", requestID,
+		"client", ClientIDFromContext(ctx),
+	)
+
 	// Make HTTP request
-	resp, err := w.HTTPClient.Get(fullURL)
+	sent = true
+	start := time.Now()
+	resp, err := w.HTTPClient.Do(req)
+	elapsed := time.Since(start)
+	metrics.UpstreamDuration.WithLabelValues(provider, what).Observe(elapsed.Seconds())
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch forecast data: %w", err)
+		// Drop the URL from transport errors: its query string carries the API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		reason := "transport"
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = "timeout"
+		}
+		metrics.UpstreamRequests.WithLabelValues(provider, what, "error").Inc()
+		metrics.UpstreamErrors.WithLabelValues(provider, what, reason).Inc()
+		logger.Warn("upstream call failed", "duration_ms", durationMillis(elapsed), "error", err)
+		return fmt.Errorf("failed to fetch %s data: %w", what, err)
 	}
 	defer resp.Body.Close()
+	metrics.UpstreamRequests.WithLabelValues(provider, what, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	// Bench our key if the provider rejected or throttled it
+	if pooledKey != "" {
+		w.Keys.Report(pooledKey, resp.StatusCode)
+	}
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		metrics.UpstreamErrors.WithLabelValues(provider, what, "status").Inc()
+		logger.Warn("upstream call failed", "status", resp.StatusCode, "duration_ms", durationMillis(elapsed))
+		return &StatusError{Provider: provider, StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	// Parse response
-	var owmResp models.OpenWeatherMapForecastResponse
-	if err := json.NewDecoder(resp.Body).Decode(&owmResp); err != nil {
-		return nil, fmt.Errorf("failed to parse API response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		metrics.UpstreamErrors.WithLabelValues(provider, what, "decode").Inc()
+		logger.Warn("upstream response could not be parsed", "status", resp.StatusCode, "error", err)
+		return fmt.Errorf("failed to parse API response: %w", err)
 	}
 
-	// Convert to our internal model
-	weatherData := w.convertForecastResponse(owmResp, days)
-	return weatherData, nil
+	logger.Debug("upstream call", "status", resp.StatusCode, "duration_ms", durationMillis(elapsed))
+	return nil
+}
+
+// durationMillis converts a duration to fractional milliseconds for log fields
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
 }
 
 // convertCurrentWeatherResponse converts OpenWeatherMap response to our internal model
@@ -166,27 +427,30 @@ func (w *WeatherService) convertCurrentWeatherResponse(owm models.OpenWeatherMap
 
 // convertForecastResponse converts OpenWeatherMap forecast response to our internal model
 func (w *WeatherService) convertForecastResponse(owm models.OpenWeatherMapForecastResponse, days int) *models.WeatherData {
-	// Group forecast items by date
+	// Group forecast items by date, remembering the order dates first appear in
 	forecastMap := make(map[string][]models.ForecastItem)
+	var dates []string
 
 	for _, item := range owm.List {
 		date := time.Unix(item.Dt, 0).Format("2006-01-02")
+		if _, ok := forecastMap[date]; !ok {
+			dates = append(dates, date)
+		}
 		forecastMap[date] = append(forecastMap[date], item)
 	}
 
-	// Convert to daily forecasts
+	// Convert to daily forecasts, earliest days first
+	sort.Strings(dates)
 	var forecasts []models.Forecast
-	count := 0
 
-	for date, items := range forecastMap {
-		if count >= days {
+	for _, date := range dates {
+		if len(forecasts) >= days {
 			break
 		}
 
 		// Calculate daily averages/extremes
-		forecast := w.calculateDailyForecast(date, items)
+		forecast := w.calculateDailyForecast(date, forecastMap[date])
 		forecasts = append(forecasts, forecast)
-		count++
 	}
 
 	return &models.WeatherData{
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"weathering-with-go/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultRetention is how long observations are kept when no retention is configured
+	DefaultRetention = 30 * 24 * time.Hour
+	// PruneInterval is how often expired observations are removed
+	PruneInterval = time.Hour
+
+	rootBucket = "observations"
+)
+
+// Timestamps the store can key: nanoseconds since the Unix epoch, which fit an int64 until 2262
+var (
+	earliestKeyTime = time.Unix(0, 0)
+	latestKeyTime   = time.Unix(0, math.MaxInt64)
+)
+
+// ObservationStore persists current-weather observations in an embedded bbolt database.
+// Observations are grouped in one bucket per location and units, keyed by timestamp,
+// so range queries are a single ordered cursor scan.
+type ObservationStore struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewObservationStore opens (or creates) the database at path, prunes expired data and starts the retention pruner
+func NewObservationStore(path string, retention time.Duration) (*ObservationStore, error) {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open observation store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(rootBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise observation store: %w", err)
+	}
+
+	s := &ObservationStore{
+		db:        db,
+		retention: retention,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	s.prune()
+	go s.pruneLoop()
+
+	return s, nil
+}
+
+// Record stores an observation, replacing any earlier reading with the same timestamp.
+// Observations from before 1970 or after 2262 cannot be keyed and are rejected.
+func (s *ObservationStore) Record(obs models.Observation) error {
+	if obs.ObservedAt.Before(earliestKeyTime) || obs.ObservedAt.After(latestKeyTime) {
+		return fmt.Errorf("observation time %s is outside the range the store can hold", obs.ObservedAt.UTC().Format(time.RFC3339))
+	}
+
+	value, err := json.Marshal(obs)
+	if err != nil {
+		return fmt.Errorf("failed to encode observation: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		series, err := tx.Bucket([]byte(rootBucket)).CreateBucketIfNotExists(seriesKey(obs.Location, obs.Units))
+		if err != nil {
+			return err
+		}
+		return series.Put(timeKey(obs.ObservedAt), value)
+	})
+}
+
+// Query returns observations for a location and units between from and to (inclusive), oldest first
+func (s *ObservationStore) Query(location, units string, from, to time.Time) ([]models.Observation, error) {
+	observations := make([]models.Observation, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		series := tx.Bucket([]byte(rootBucket)).Bucket(seriesKey(location, units))
+		if series == nil {
+			return nil
+		}
+
+		max := timeKey(to)
+		c := series.Cursor()
+		for k, v := c.Seek(timeKey(from)); k != nil && bytes.Compare(k, max) <= 0; k, v = c.Next() {
+			var obs models.Observation
+			if err := json.Unmarshal(v, &obs); err != nil {
+				return fmt.Errorf("failed to decode observation: %w", err)
+			}
+			observations = append(observations, obs)
+		}
+		return nil
+	})
+
+	return observations, err
+}
+
+// Prune removes observations older than the retention period and returns how many were deleted.
+// Series left empty are removed too, so locations no longer queried do not pile up.
+func (s *ObservationStore) Prune() (int, error) {
+	cutoff := timeKey(time.Now().Add(-s.retention))
+	removed := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(rootBucket))
+		var empty [][]byte
+		err := root.ForEachBucket(func(name []byte) error {
+			c := root.Bucket(name).Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+			if k, _ := c.First(); k == nil {
+				empty = append(empty, bytes.Clone(name))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Buckets cannot be deleted while iterating over them
+		for _, name := range empty {
+			if err := root.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return removed, err
+}
+
+// Ping reports whether the database is open and readable
+func (s *ObservationStore) Ping() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(rootBucket)) == nil {
+			return fmt.Errorf("observation store is missing its %q bucket", rootBucket)
+		}
+		return nil
+	})
+}
+
+// Close stops the pruner and closes the database
+func (s *ObservationStore) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = s.db.Close()
+	})
+	return err
+}
+
+// pruneLoop prunes expired observations every PruneInterval until the store is closed
+func (s *ObservationStore) pruneLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.prune()
+		}
+	}
+}
+
+// prune runs Prune and logs the outcome
+func (s *ObservationStore) prune() {
+	if removed, err := s.Prune(); err != nil {
+		slog.Warn("failed to prune observations", "error", err)
+	} else if removed > 0 {
+		slog.Info("pruned expired observations", "removed", removed)
+	}
+}
+
+// seriesKey normalises a location and units pair into a bucket name
+func seriesKey(location, units string) []byte {
+	return []byte(strings.ToLower(strings.TrimSpace(location)) + "|" + units)
+}
+
+// timeKey encodes a timestamp so that byte order matches chronological order. Times outside
+// the range Record accepts are clamped to it, so range bounds beyond it still scan correctly.
+func timeKey(t time.Time) []byte {
+	var nanos uint64
+	switch {
+	case t.Before(earliestKeyTime):
+		nanos = 0
+	case t.After(latestKeyTime):
+		nanos = math.MaxInt64
+	default:
+		nanos = uint64(t.UnixNano())
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, nanos)
+	return key
+}
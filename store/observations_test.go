@@ -0,0 +1,124 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"weathering-with-go/models"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	s, err := NewObservationStore(filepath.Join(t.TempDir(), "obs.db"), time.Hour)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		obs := models.Observation{
+			Location:   "London,UK",
+			Units:      "metric",
+			ObservedAt: now.Add(time.Duration(-i) * 10 * time.Minute),
+			Current:    models.Current{Temperature: float64(i)},
+		}
+		if err := s.Record(obs); err != nil {
+			t.Fatalf("record failed: %v", err)
+		}
+	}
+
+	got, err := s.Query(" london,uk ", "metric", now.Add(-15*time.Minute), now)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 observations got %d", len(got))
+	}
+	if !got[0].ObservedAt.Before(got[1].ObservedAt) {
+		t.Fatalf("expected observations oldest first")
+	}
+
+	other, err := s.Query("London,UK", "imperial", now.Add(-time.Hour), now)
+	if err != nil || len(other) != 0 {
+		t.Fatalf("expected no imperial observations got %d (err=%v)", len(other), err)
+	}
+}
+
+func TestPruneRemovesExpired(t *testing.T) {
+	s, err := NewObservationStore(filepath.Join(t.TempDir(), "obs.db"), time.Hour)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	s.Record(models.Observation{Location: "Paris,FR", Units: "metric", ObservedAt: now.Add(-2 * time.Hour)})
+	s.Record(models.Observation{Location: "Paris,FR", Units: "metric", ObservedAt: now})
+
+	removed, err := s.Prune()
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 expired observation removed got %d", removed)
+	}
+}
+
+func TestPruneRemovesEmptySeries(t *testing.T) {
+	s, err := NewObservationStore(filepath.Join(t.TempDir(), "obs.db"), time.Hour)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	s.Record(models.Observation{Location: "Paris,FR", Units: "metric", ObservedAt: now.Add(-2 * time.Hour)})
+	s.Record(models.Observation{Location: "Rome,IT", Units: "metric", ObservedAt: now})
+
+	if _, err := s.Prune(); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+
+	var series []string
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(rootBucket)).ForEachBucket(func(name []byte) error {
+			series = append(series, string(name))
+			return nil
+		})
+	})
+	if len(series) != 1 || string(seriesKey("Rome,IT", "metric")) != series[0] {
+		t.Fatalf("expected only the Rome series to remain, got %q", series)
+	}
+}
+
+func TestQueryOutsideKeyRange(t *testing.T) {
+	s, err := NewObservationStore(filepath.Join(t.TempDir(), "obs.db"), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	if err := s.Record(models.Observation{Location: "Oslo,NO", Units: "metric", ObservedAt: now}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	if err := s.Record(models.Observation{Location: "Oslo,NO", Units: "metric", ObservedAt: time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)}); err == nil {
+		t.Fatalf("expected pre-1970 observation to be rejected")
+	}
+
+	got, err := s.Query("Oslo,NO", "metric", time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected a range reaching past the key range to find 1 observation, got %d", len(got))
+	}
+
+	got, err = s.Query("Oslo,NO", "metric", time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(1965, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(got) != 0 {
+		t.Fatalf("expected a pre-1970 range to be empty, got %d (err=%v)", len(got), err)
+	}
+}
@@ -0,0 +1,193 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"weathering-with-go/config"
+)
+
+// ReloadCheckInterval is how often the certificate and key files are checked for changes
+const ReloadCheckInterval = 30 * time.Second
+
+// New builds the server's TLS configuration: TLS 1.2 or later, the certificate served through a
+// CertReloader and, when a client CA bundle is configured, client certificate verification.
+// Close the returned reloader on shutdown.
+func New(cfg *config.Config, logger *slog.Logger) (*tls.Config, *CertReloader, error) {
+	reloader, err := NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		pool, err := loadCertPool(cfg.TLSClientCAFile)
+		if err != nil {
+			reloader.Close()
+			return nil, nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.TLSClientAuth == "require" {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsConfig, reloader, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA file %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	modTime int64 // nanoseconds since the Unix epoch
+	size    int64
+}
+
+// CertReloader serves a certificate loaded from disk and reloads it when the certificate or key
+// file changes, so renewed certificates are picked up without a restart. A failed reload keeps
+// serving the previous certificate.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certStat fileStamp
+	keyStat  fileStamp
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewCertReloader loads the key pair and starts watching both files for changes
+func NewCertReloader(certFile, keyFile string, logger *slog.Logger) (*CertReloader, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	go r.watch()
+	return r, nil
+}
+
+// GetCertificate returns the current certificate; it is used as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload reads the key pair from disk and serves it for new connections
+func (r *CertReloader) Reload() error {
+	// Stat before reading, so a change made while loading is picked up by the next check
+	certStat, err := stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyStat, err := stat(r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certStat, r.keyStat = certStat, keyStat
+	r.mu.Unlock()
+	return nil
+}
+
+// Close stops watching the certificate files
+func (r *CertReloader) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
+
+// watch checks for changed files every ReloadCheckInterval until the reloader is closed
+func (r *CertReloader) watch() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(ReloadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// check reloads the key pair if either file changed since it was last loaded, logging the outcome
+func (r *CertReloader) check() {
+	certStat, certErr := stat(r.certFile)
+	keyStat, keyErr := stat(r.keyFile)
+	if certErr != nil || keyErr != nil {
+		// Files are often replaced non-atomically; try again on the next check
+		return
+	}
+
+	r.mu.RLock()
+	changed := certStat != r.certStat || keyStat != r.keyStat
+	r.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := r.Reload(); err != nil {
+		r.logger.Warn("failed to reload TLS certificate; keeping the previous one", "error", err)
+		return
+	}
+	r.logger.Info("reloaded TLS certificate", "cert_file", r.certFile)
+}
+
+// stat returns the current stamp of a file, following symlinks as mounted secrets use them
+func stat(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("failed to read TLS file: %w", err)
+	}
+	return fileStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}, nil
+}
@@ -0,0 +1,209 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"weathering-with-go/config"
+	"weathering-with-go/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// issue creates a certificate for name signed by parent (self-signed when parent is nil)
+func issue(t *testing.T, name string, serial int64, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedSerial(t *testing.T, r *CertReloader) int64 {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderPicksUpChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Minute)
+
+	_, _, certPEM, keyPEM := issue(t, "localhost", 1, false, nil, nil)
+	writeFile(t, certFile, certPEM, start)
+	writeFile(t, keyFile, keyPEM, start)
+
+	r, err := NewCertReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+	if got := servedSerial(t, r); got != 1 {
+		t.Fatalf("expected serial 1, got %d", got)
+	}
+
+	// Unchanged files are not reloaded
+	r.check()
+	if got := servedSerial(t, r); got != 1 {
+		t.Fatalf("expected serial 1, got %d", got)
+	}
+
+	// A renewed certificate is served after the next check
+	_, _, certPEM, keyPEM = issue(t, "localhost", 2, false, nil, nil)
+	writeFile(t, certFile, certPEM, start.Add(time.Second))
+	writeFile(t, keyFile, keyPEM, start.Add(time.Second))
+	r.check()
+	if got := servedSerial(t, r); got != 2 {
+		t.Fatalf("expected renewed serial 2, got %d", got)
+	}
+
+	// A broken update keeps the previous certificate
+	writeFile(t, certFile, []byte("not a certificate"), start.Add(2*time.Second))
+	r.check()
+	if got := servedSerial(t, r); got != 2 {
+		t.Fatalf("expected serial 2 to be kept, got %d", got)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	ca, caKey, caPEM, _ := issue(t, "Test CA", 10, true, nil, nil)
+	_, _, serverPEM, serverKeyPEM := issue(t, "localhost", 11, false, ca, caKey)
+	_, _, clientPEM, clientKeyPEM := issue(t, "billing-service", 12, false, ca, caKey)
+
+	cfg := &config.Config{
+		TLSCertFile:     filepath.Join(dir, "server.crt"),
+		TLSKeyFile:      filepath.Join(dir, "server.key"),
+		TLSClientCAFile: filepath.Join(dir, "ca.crt"),
+		TLSClientAuth:   "require",
+		TLSClientScopes: []string{middleware.ScopeWeatherRead, middleware.ScopeMetrics},
+	}
+	now := time.Now()
+	writeFile(t, cfg.TLSCertFile, serverPEM, now)
+	writeFile(t, cfg.TLSKeyFile, serverKeyPEM, now)
+	writeFile(t, cfg.TLSClientCAFile, caPEM, now)
+
+	tlsConfig, reloader, err := New(cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reloader.Close()
+
+	router := gin.New()
+	router.Use(middleware.ClientCertAuth(cfg))
+	router.GET("/whoami", middleware.RequireScopes(middleware.ScopeMetrics), func(c *gin.Context) {
+		principal, _ := middleware.PrincipalFromContext(c)
+		c.String(http.StatusOK, principal.Method+":"+principal.Subject+" "+middleware.ClientID(c))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: router, TLSConfig: tlsConfig}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	url := "https://" + listener.Addr().String() + "/whoami"
+
+	// Without a client certificate the handshake fails
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := anonymous.Get(url); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected the handshake to fail without a client certificate, got %d", resp.StatusCode)
+	}
+
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(body) != "mtls:billing-service mtls:billing-service" {
+		t.Fatalf("unexpected response %d: %s", resp.StatusCode, body)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2 over TLS, got %s", resp.Proto)
+	}
+
+	// Unless required, certificates are verified when given but not demanded
+	optional := *cfg
+	optional.TLSClientAuth = ""
+	optionalConfig, optionalReloader, err := New(&optional, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer optionalReloader.Close()
+	if optionalConfig.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Fatalf("expected optional client certificates by default, got %v", optionalConfig.ClientAuth)
+	}
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"weathering-with-go/buildinfo"
+	"weathering-with-go/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup installs a global tracer provider exporting spans over OTLP/HTTP to cfg.TracingEndpoint,
+// together with W3C Trace Context and Baggage propagation. When no endpoint is configured tracing
+// stays disabled: the global no-op provider is kept and the returned shutdown does nothing.
+// Call shutdown before exiting to flush buffered spans.
+func Setup(ctx context.Context, cfg *config.Config) (shutdown func(context.Context) error, err error) {
+	if cfg.TracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.TracingEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", cfg.TracingServiceName),
+		attribute.String("service.version", buildinfo.Get().Version),
+		attribute.String("deployment.environment", cfg.Environment),
+	)
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
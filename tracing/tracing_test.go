@@ -0,0 +1,161 @@
+package tracing_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"weathering-with-go/config"
+	"weathering-with-go/handlers"
+	"weathering-with-go/middleware"
+	"weathering-with-go/services"
+	"weathering-with-go/tracing"
+
+	"github.com/gin-gonic/gin"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an in-process stand-in for an OTLP/HTTP collector
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req collectortrace.ExportTraceServiceRequest
+	if r.URL.Path != "/v1/traces" || proto.Unmarshal(body, &req) != nil {
+		http.Error(w, "bad export", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	out, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Write(out)
+}
+
+func (c *collector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func attr(span *tracepb.Span, key string) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			if s := kv.Value.GetStringValue(); s != "" {
+				return s
+			}
+			return fmt.Sprint(kv.Value.GetIntValue())
+		}
+	}
+	return ""
+}
+
+// upstreamTransport sends every upstream call to the fake provider
+type upstreamTransport struct{ target string }
+
+func (t upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "http"
+	r.URL.Host = strings.TrimPrefix(t.target, "http://")
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestTracesExportedAcrossHandlersAndProviderCalls(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	col := &collector{}
+	colSrv := httptest.NewServer(col)
+	defer colSrv.Close()
+
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"weather":[{"main":"Clear","description":"clear sky","icon":"01d"}],"main":{"temp":10.5},"name":"Testville"}`)
+	}))
+	defer upstream.Close()
+
+	shutdown, err := tracing.Setup(context.Background(), &config.Config{
+		TracingEndpoint:    colSrv.URL + "/v1/traces",
+		TracingServiceName: "weathering-test",
+		TracingSampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	svc := services.NewWeatherService("server-secret-key")
+	svc.HTTPClient = &http.Client{Transport: upstreamTransport{target: upstream.URL}}
+
+	router := gin.New()
+	router.Use(middleware.Tracing("weathering-test"), middleware.RequestID())
+	router.GET("/api/v1/weather/current", handlers.NewWeatherHandler(svc).GetCurrentWeather)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/weather/current?location=Testville&units=metric", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to flush spans: %v", err)
+	}
+
+	server := col.span("/api/v1/weather/current")
+	service := col.span("WeatherService.GetCurrentWeather")
+	client := col.span("GET openweathermap weather")
+	if server == nil || service == nil || client == nil {
+		t.Fatalf("missing spans, got %d spans", len(col.spans))
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, span := range []*tracepb.Span{server, service, client} {
+		if fmt.Sprintf("%x", span.TraceId) != traceID {
+			t.Fatalf("span %s did not continue the incoming trace", span.Name)
+		}
+	}
+	if string(service.ParentSpanId) != string(server.SpanId) || string(client.ParentSpanId) != string(service.SpanId) {
+		t.Fatalf("spans are not nested server > service > client")
+	}
+
+	if attr(service, "weather.location") != "Testville" || attr(service, "weather.units") != "metric" {
+		t.Fatalf("missing service attributes")
+	}
+	if attr(client, "weather.provider") != services.ProviderOpenWeatherMap || attr(client, "http.response.status_code") != "200" {
+		t.Fatalf("missing client attributes")
+	}
+	if attr(server, "request.id") != traceID {
+		t.Fatalf("expected request ID on server span, got %q", attr(server, "request.id"))
+	}
+	if strings.Contains(attr(client, "url.full"), "server-secret-key") {
+		t.Fatalf("API key leaked into span attributes")
+	}
+
+	if !strings.Contains(upstreamTraceparent, traceID) || !strings.Contains(upstreamTraceparent, fmt.Sprintf("%x", client.SpanId)) {
+		t.Fatalf("expected trace context to be propagated upstream, got %q", upstreamTraceparent)
+	}
+}
@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"weathering-with-go/models"
@@ -59,30 +62,20 @@ func (e *APIError) AddValidationError(field, message, value string) {
 	e.Validation = append(e.Validation, NewValidationError(field, message, value))
 }
 
-// SendError sends a structured error response
-func SendError(c *gin.Context, err error) {
-	var statusCode int
-	var apiErr *APIError
+// RequestIDKey is the gin context key holding the request ID
+const RequestIDKey = "request_id"
 
-	switch e := err.(type) {
-	case *APIError:
-		statusCode = e.Code
-		apiErr = e
-	default:
-		statusCode = http.StatusInternalServerError
-		apiErr = NewAPIError(statusCode, "Internal server error", err.Error())
-	}
+// SendError sends a structured error response tagged with the request ID
+func SendError(c *gin.Context, err error) {
+	errResp := ToErrorResponse(err)
+	errResp.RequestID = c.GetString(RequestIDKey)
 
 	response := models.APIResponse{
 		Success: false,
-		Error: &models.ErrorResponse{
-			Error:   http.StatusText(statusCode),
-			Code:    statusCode,
-			Message: apiErr.Message,
-		},
+		Error:   errResp,
 	}
 
-	c.JSON(statusCode, response)
+	c.JSON(errResp.Code, response)
 }
 
 // SendSuccess sends a successful response
@@ -146,27 +139,204 @@ func ValidateDays(days int) error {
 	return nil
 }
 
-// HandleWeatherAPIError handles errors from the weather service
-func HandleWeatherAPIError(err error) error {
-	errMsg := err.Error()
-	
-	// Check for common API errors
-	if strings.Contains(errMsg, "status 401") {
-		return NewAPIError(http.StatusUnauthorized, "Invalid API key", "Please check your OpenWeatherMap API key")
+// MaxBatchItems is the largest number of locations accepted in one batch request
+const MaxBatchItems = 50
+
+// ValidateBatch validates the type and size of a batch request
+func ValidateBatch(batchType string, items int) error {
+	if batchType != "" && batchType != "current" && batchType != "forecast" {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid type parameter")
+		apiErr.AddValidationError("type", "Must be one of: current, forecast", batchType)
+		return apiErr
 	}
-	
-	if strings.Contains(errMsg, "status 404") {
-		return NewAPIError(http.StatusNotFound, "Location not found", "The specified location could not be found")
+
+	if items < 1 {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid batch request")
+		apiErr.AddValidationError("items", "Must contain at least 1 item", fmt.Sprintf("%d", items))
+		return apiErr
 	}
-	
-	if strings.Contains(errMsg, "status 429") {
-		return NewAPIError(http.StatusTooManyRequests, "Rate limit exceeded", "Please try again later")
+
+	if items > MaxBatchItems {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid batch request")
+		apiErr.AddValidationError("items", fmt.Sprintf("Must contain %d items or less", MaxBatchItems), fmt.Sprintf("%d", items))
+		return apiErr
 	}
-	
-	if strings.Contains(errMsg, "timeout") || strings.Contains(errMsg, "connection") {
-		return NewAPIError(http.StatusServiceUnavailable, "Weather service temporarily unavailable", "Please try again later")
+
+	return nil
+}
+
+// BindError converts a request body binding error into an API error; bodies cut off by the
+// size limit get 413 rather than 400
+func BindError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return NewAPIError(http.StatusRequestEntityTooLarge, "Request body too large",
+			fmt.Sprintf("Request bodies are limited to %d bytes", maxBytesErr.Limit))
 	}
-	
-	// Default to internal server error
-	return NewAPIError(http.StatusInternalServerError, "Weather service error", errMsg)
+	return NewAPIError(http.StatusBadRequest, "Invalid request body", err.Error())
+}
+
+// ToErrorResponse converts an error into the error body used in API responses
+func ToErrorResponse(err error) *models.ErrorResponse {
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		apiErr = NewAPIError(http.StatusInternalServerError, "Internal server error", err.Error())
+	}
+
+	return &models.ErrorResponse{
+		Error:   http.StatusText(apiErr.Code),
+		Code:    apiErr.Code,
+		Message: apiErr.Message,
+	}
+}
+
+// Comparison size limits
+const (
+	MinCompareLocations = 2
+	MaxCompareLocations = 10
+)
+
+// ValidateCompareLocations validates the list of locations for a comparison
+func ValidateCompareLocations(locations []string) error {
+	if len(locations) < MinCompareLocations || len(locations) > MaxCompareLocations {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid location parameter")
+		apiErr.AddValidationError("location", fmt.Sprintf("Provide between %d and %d locations", MinCompareLocations, MaxCompareLocations), fmt.Sprintf("%d", len(locations)))
+		return apiErr
+	}
+
+	for _, location := range locations {
+		if err := ValidateLocation(location); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// History range limits
+const (
+	MaxHistoryDaysDaily  = 366
+	MaxHistoryDaysHourly = 31
+)
+
+// EarliestHistoryDate is the first date covered by the historical weather archive
+var EarliestHistoryDate = time.Date(1940, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Bounds of the observation time-series queries; the store keys observations by nanoseconds since 1970
+var (
+	EarliestObservationTime = time.Unix(0, 0).UTC()
+	LatestObservationTime   = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// ValidateInterval validates a history interval parameter
+func ValidateInterval(interval string) error {
+	if interval == "" || interval == "daily" || interval == "hourly" {
+		return nil
+	}
+
+	apiErr := NewAPIError(http.StatusBadRequest, "Invalid interval parameter")
+	apiErr.AddValidationError("interval", "Must be one of: hourly, daily", interval)
+	return apiErr
+}
+
+// ValidateDateRange parses and validates a start/end date pair (YYYY-MM-DD) for history lookups
+func ValidateDateRange(startStr, endStr, interval string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", startStr)
+	if err != nil {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid start parameter")
+		apiErr.AddValidationError("start", "Must be a date in YYYY-MM-DD format", startStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	end, err := time.Parse("2006-01-02", endStr)
+	if err != nil {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid end parameter")
+		apiErr.AddValidationError("end", "Must be a date in YYYY-MM-DD format", endStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	if end.Before(start) {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid date range")
+		apiErr.AddValidationError("end", "Must not be before start", endStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	if start.Before(EarliestHistoryDate) {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid date range")
+		apiErr.AddValidationError("start", "Must be on or after "+EarliestHistoryDate.Format("2006-01-02"), startStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !end.Before(today) {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid date range")
+		apiErr.AddValidationError("end", "Must be in the past; use the forecast endpoint for today onwards", endStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	maxDays := MaxHistoryDaysDaily
+	if interval == "hourly" {
+		maxDays = MaxHistoryDaysHourly
+	}
+	if days := int(end.Sub(start).Hours()/24) + 1; days > maxDays {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid date range")
+		apiErr.AddValidationError("end", fmt.Sprintf("Range must cover at most %d days for %s data", maxDays, interval), endStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	return start, end, nil
+}
+
+// ValidateTimeRange parses an optional from/to pair (RFC 3339 or YYYY-MM-DD) for time-series queries.
+// Missing bounds default to the 24 hours leading up to now.
+func ValidateTimeRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if toStr != "" {
+		parsed, err := parseTimeParam(toStr)
+		if err != nil {
+			apiErr := NewAPIError(http.StatusBadRequest, "Invalid to parameter")
+			apiErr.AddValidationError("to", "Must be an RFC 3339 timestamp or YYYY-MM-DD date", toStr)
+			return time.Time{}, time.Time{}, apiErr
+		}
+		to = parsed
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if fromStr != "" {
+		parsed, err := parseTimeParam(fromStr)
+		if err != nil {
+			apiErr := NewAPIError(http.StatusBadRequest, "Invalid from parameter")
+			apiErr.AddValidationError("from", "Must be an RFC 3339 timestamp or YYYY-MM-DD date", fromStr)
+			return time.Time{}, time.Time{}, apiErr
+		}
+		from = parsed
+	}
+
+	if to.Before(from) {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid time range")
+		apiErr.AddValidationError("to", "Must not be before from", toStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	bounds := "Must be between " + EarliestObservationTime.Format("2006-01-02") + " and " + LatestObservationTime.Format(time.RFC3339)
+	if from.Before(EarliestObservationTime) {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid time range")
+		apiErr.AddValidationError("from", bounds, fromStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+	if to.After(LatestObservationTime) {
+		apiErr := NewAPIError(http.StatusBadRequest, "Invalid time range")
+		apiErr.AddValidationError("to", bounds, toStr)
+		return time.Time{}, time.Time{}, apiErr
+	}
+
+	return from, to, nil
+}
+
+// parseTimeParam accepts either an RFC 3339 timestamp or a plain date
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
 }
\ No newline at end of file
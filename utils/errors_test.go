@@ -1,6 +1,9 @@
 package utils
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestValidateLocation(t *testing.T) {
 	if err := ValidateLocation(""); err == nil {
@@ -37,3 +40,40 @@ func TestValidateDays(t *testing.T) {
 		t.Fatalf("unexpected error for days=3: %v", err)
 	}
 }
+
+func TestValidateDateRange(t *testing.T) {
+	if _, _, err := ValidateDateRange("2026-03-01", "2026-03-02", "daily"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := ValidateDateRange("01/03/2026", "2026-03-02", "daily"); err == nil {
+		t.Fatalf("expected error for malformed start")
+	}
+	if _, _, err := ValidateDateRange("2026-03-02", "2026-03-01", "daily"); err == nil {
+		t.Fatalf("expected error for end before start")
+	}
+	if _, _, err := ValidateDateRange("1930-01-01", "1930-01-02", "daily"); err == nil {
+		t.Fatalf("expected error for dates before the archive starts")
+	}
+	if _, _, err := ValidateDateRange("2026-01-01", "2026-03-01", "hourly"); err == nil {
+		t.Fatalf("expected error for hourly range over the limit")
+	}
+	future := time.Now().AddDate(0, 0, 2).Format("2006-01-02")
+	if _, _, err := ValidateDateRange("2026-03-01", future, "daily"); err == nil {
+		t.Fatalf("expected error for end date in the future")
+	}
+}
+
+func TestValidateTimeRange(t *testing.T) {
+	if _, _, err := ValidateTimeRange("2026-03-01", "2026-03-02T12:00:00Z"); err != nil {
+		t.Fatalf("expected valid time range, got %v", err)
+	}
+	if _, _, err := ValidateTimeRange("2026-03-02", "2026-03-01"); err == nil {
+		t.Fatalf("expected error for to before from")
+	}
+	if _, _, err := ValidateTimeRange("1960-01-01", "2026-03-01"); err == nil {
+		t.Fatalf("expected error for from before 1970")
+	}
+	if _, _, err := ValidateTimeRange("2026-03-01", "2300-01-01"); err == nil {
+		t.Fatalf("expected error for to after 2262")
+	}
+}